@@ -0,0 +1,204 @@
+// Command mockoidc runs a minimal OpenID Connect issuer for local development.
+// It auto-approves every authorization request, so the server's OIDC login can
+// be exercised end to end without a real identity provider:
+//
+//	go run ./cmd/mockoidc
+//	OIDC_ISSUER_URL=http://localhost:9090 OIDC_CLIENT_ID=notify \
+//	OIDC_REDIRECT_URL=http://localhost:8080/user/oidc/callback go run ./cmd/server
+//
+// Then open http://localhost:8080/user/oidc/login?login_hint=jane@example.com
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const keyID = "mock-key"
+
+type authCode struct {
+	ClientID      string
+	RedirectURI   string
+	Nonce         string
+	Email         string
+	CodeChallenge string
+	Expires       time.Time
+}
+
+type mockIssuer struct {
+	issuer string
+	key    *rsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]authCode
+}
+
+func main() {
+	port := os.Getenv("MOCK_OIDC_PORT")
+	if port == "" {
+		port = "9090"
+	}
+	issuer := os.Getenv("MOCK_OIDC_ISSUER")
+	if issuer == "" {
+		issuer = "http://localhost:" + port
+	}
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		log.Fatal(err)
+	}
+	m := &mockIssuer{issuer: issuer, key: key, codes: make(map[string]authCode)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", m.discovery)
+	mux.HandleFunc("/jwks", m.jwks)
+	mux.HandleFunc("/authorize", m.authorize)
+	mux.HandleFunc("/token", m.token)
+
+	log.Println("Mock OIDC issuer listening on", issuer)
+	log.Fatal(http.ListenAndServe(":"+port, mux))
+}
+
+func (m *mockIssuer) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"issuer":                                m.issuer,
+		"authorization_endpoint":                m.issuer + "/authorize",
+		"token_endpoint":                        m.issuer + "/token",
+		"jwks_uri":                              m.issuer + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+func (m *mockIssuer) jwks(w http.ResponseWriter, r *http.Request) {
+	pub := m.key.PublicKey
+	writeJSON(w, http.StatusOK, map[string]any{
+		"keys": []map[string]string{{
+			"kid": keyID,
+			"kty": "RSA",
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}},
+	})
+}
+
+// authorize skips any login UI and immediately redirects back with a code.
+// The identity is taken from login_hint, falling back to MOCK_OIDC_EMAIL.
+func (m *mockIssuer) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	redirectURI := q.Get("redirect_uri")
+	if redirectURI == "" || q.Get("response_type") != "code" {
+		http.Error(w, "redirect_uri and response_type=code are required", http.StatusBadRequest)
+		return
+	}
+
+	email := q.Get("login_hint")
+	if email == "" {
+		email = os.Getenv("MOCK_OIDC_EMAIL")
+	}
+	if email == "" {
+		email = "mock.user@example.com"
+	}
+
+	code := randomString()
+	m.mu.Lock()
+	m.codes[code] = authCode{
+		ClientID:      q.Get("client_id"),
+		RedirectURI:   redirectURI,
+		Nonce:         q.Get("nonce"),
+		Email:         email,
+		CodeChallenge: q.Get("code_challenge"),
+		Expires:       time.Now().Add(time.Minute),
+	}
+	m.mu.Unlock()
+
+	target, err := url.Parse(redirectURI)
+	if err != nil {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+	params := target.Query()
+	params.Set("code", code)
+	params.Set("state", q.Get("state"))
+	target.RawQuery = params.Encode()
+	http.Redirect(w, r, target.String(), http.StatusFound)
+}
+
+func (m *mockIssuer) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	m.mu.Lock()
+	ac, ok := m.codes[r.PostForm.Get("code")]
+	delete(m.codes, r.PostForm.Get("code"))
+	m.mu.Unlock()
+
+	if !ok || time.Now().After(ac.Expires) || ac.RedirectURI != r.PostForm.Get("redirect_uri") {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+	if ac.CodeChallenge != "" {
+		sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+		if base64.RawURLEncoding.EncodeToString(sum[:]) != ac.CodeChallenge {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant", "error_description": "PKCE verification failed"})
+			return
+		}
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":            m.issuer,
+		"sub":            "mock|" + ac.Email,
+		"aud":            ac.ClientID,
+		"iat":            now.Unix(),
+		"exp":            now.Add(5 * time.Minute).Unix(),
+		"nonce":          ac.Nonce,
+		"email":          ac.Email,
+		"email_verified": true,
+		"name":           ac.Email,
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = keyID
+	idToken, err := token.SignedString(m.key)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"access_token": randomString(),
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     idToken,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func randomString() string {
+	b := make([]byte, 24)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
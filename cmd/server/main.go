@@ -11,6 +11,7 @@ import (
 	"github.com/joho/godotenv"
 	config "github.com/sachinggsingh/notify/internal/config"
 	controller "github.com/sachinggsingh/notify/internal/controllers"
+	"github.com/sachinggsingh/notify/internal/queue"
 	routes "github.com/sachinggsingh/notify/internal/routes"
 )
 
@@ -38,20 +39,72 @@ func main() {
 	})
 
 	router.Use(gin.Logger())
-	config.InitCloudinary()
 	if err := config.InitRedis(); err != nil {
 		log.Fatal(err)
 	}
+	if err := config.InitRateLimits(); err != nil {
+		log.Fatal(err)
+	}
+	if err := config.InitOIDC(); err != nil {
+		log.Fatal(err)
+	}
+	if err := config.InitAccount(); err != nil {
+		log.Fatal(err)
+	}
+	if err := config.InitMailer(); err != nil {
+		log.Fatal(err)
+	}
+	if err := config.InitUpload(); err != nil {
+		log.Fatal(err)
+	}
+	if err := config.InitStorage(); err != nil {
+		log.Fatal(err)
+	}
+	if err := config.InitCaptioner(); err != nil {
+		log.Fatal(err)
+	}
+	if err := config.InitModerator(); err != nil {
+		log.Fatal(err)
+	}
+	if err := config.InitJobs(); err != nil {
+		log.Fatal(err)
+	}
+	if err := config.InitWebsocket(); err != nil {
+		log.Fatal(err)
+	}
+	if err := config.InitRetention(); err != nil {
+		log.Fatal(err)
+	}
+	if err := controller.EnsureIndexes(context.Background()); err != nil {
+		log.Fatal(err)
+	}
 
 	// Register routes (auth applied within route groups)
 	routes.UserRoutes(router)
+	routes.ProfileRoutes(router)
+	routes.AdminRoutes(router)
 	routes.ImageRoutes(router)
+	routes.FileRoutes(router)
 	routes.WebsocketRoutes(router)
 	routes.PubSubRoutes(router)
 
+	// Let WebSocket clients publish through the same path as POST /protected/publish
+	config.HubInstance.OnPublish = controller.PublishFromClient
+
 	// Start background Redis subscriber
 	go controller.StartRedisSubscriber(context.Background())
 
+	// Publish scheduled messages when they are due
+	go controller.StartScheduler(context.Background())
+
+	// Apply message retention policies
+	go controller.StartRetentionCompactor(context.Background())
+
+	// Start background job workers
+	queue.Handle(controller.CaptionJob, controller.HandleCaptionJob)
+	queue.Handle(controller.AccountMailJob, controller.HandleAccountMailJob)
+	go queue.Run(context.Background())
+
 	router.Run(":" + port)
 
 }
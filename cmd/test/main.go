@@ -4,6 +4,9 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"image"
+	"image/color"
+	"image/png"
 	"io"
 	"log"
 	"mime/multipart"
@@ -230,14 +233,13 @@ func uploadImage(baseUrl, token string) (ImageResponse, error) {
 	writer := multipart.NewWriter(&buf)
 
 	// Create a sample image file part
-	fw, err := writer.CreateFormFile("image", "test-image.jpg")
+	fw, err := writer.CreateFormFile("image", "test-image.png")
 	if err != nil {
 		return result, fmt.Errorf("create form file: %w", err)
 	}
 
-	// Write some sample image data (you can replace this with a real image file)
-	_, err = fw.Write([]byte("sample image content"))
-	if err != nil {
+	// The server decodes uploads, so send a real (tiny) PNG
+	if err := png.Encode(fw, sampleImage()); err != nil {
 		return result, fmt.Errorf("write file content: %w", err)
 	}
 
@@ -285,3 +287,14 @@ func uploadImage(baseUrl, token string) (ImageResponse, error) {
 
 	return result, nil
 }
+
+// sampleImage draws a small gradient so the upload passes server-side image validation
+func sampleImage() image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, 64, 64))
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 64; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x * 4), G: uint8(y * 4), B: 160, A: 255})
+		}
+	}
+	return img
+}
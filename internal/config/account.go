@@ -0,0 +1,107 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sachinggsingh/notify/internal/models"
+)
+
+type AccountSettings struct {
+	MaxFailedLogins      int
+	LockoutDuration      time.Duration
+	RequireVerifiedEmail bool
+	VerificationTTL      time.Duration
+	PasswordResetTTL     time.Duration
+	AppBaseURL           string
+	AdminEmails          map[string]bool
+}
+
+var Account = AccountSettings{
+	MaxFailedLogins:  5,
+	LockoutDuration:  15 * time.Minute,
+	VerificationTTL:  48 * time.Hour,
+	PasswordResetTTL: time.Hour,
+	AppBaseURL:       "http://localhost:8080",
+	AdminEmails:      map[string]bool{},
+}
+
+func InitAccount() error {
+	if v := os.Getenv("LOGIN_MAX_ATTEMPTS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return fmt.Errorf("invalid LOGIN_MAX_ATTEMPTS %q", v)
+		}
+		Account.MaxFailedLogins = n
+	}
+	durations := map[string]*time.Duration{
+		"LOGIN_LOCKOUT_DURATION": &Account.LockoutDuration,
+		"VERIFICATION_TOKEN_TTL": &Account.VerificationTTL,
+		"PASSWORD_RESET_TTL":     &Account.PasswordResetTTL,
+	}
+	for name, target := range durations {
+		if v := os.Getenv(name); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil || d <= 0 {
+				return fmt.Errorf("invalid %s %q", name, v)
+			}
+			*target = d
+		}
+	}
+	Account.RequireVerifiedEmail = os.Getenv("REQUIRE_EMAIL_VERIFICATION") == "true"
+	if v := os.Getenv("APP_BASE_URL"); v != "" {
+		Account.AppBaseURL = strings.TrimSuffix(v, "/")
+	}
+	for _, email := range strings.Split(os.Getenv("ADMIN_EMAILS"), ",") {
+		if email = strings.ToLower(strings.TrimSpace(email)); email != "" {
+			Account.AdminEmails[email] = true
+		}
+	}
+	return nil
+}
+
+// RoleFor promotes verified addresses listed in ADMIN_EMAILS and otherwise keeps the stored
+// role. An unverified address could belong to anyone, so it never grants admin.
+func RoleFor(user models.User) string {
+	if user.Verified && user.Email != nil && IsAdminEmail(*user.Email) {
+		return models.RoleAdmin
+	}
+	if user.Role == "" {
+		return models.RoleUser
+	}
+	return user.Role
+}
+
+func IsAdminEmail(email string) bool {
+	return Account.AdminEmails[strings.ToLower(strings.TrimSpace(email))]
+}
+
+// RevokedUserKey marks a user whose outstanding tokens must be rejected
+func RevokedUserKey(userID string) string {
+	return "revoked:user:" + userID
+}
+
+// SessionGenerationKey counts how often a user's sessions were ended. Tokens carry the
+// generation they were issued in and are rejected once it has moved on.
+func SessionGenerationKey(userID string) string {
+	return "sessions:gen:" + userID
+}
+
+// SessionGeneration returns the generation new tokens for the user are issued in
+func SessionGeneration(ctx context.Context, userID string) (int64, error) {
+	gen, err := RDB.Get(ctx, SessionGenerationKey(userID)).Int64()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	return gen, err
+}
+
+// EndSessions invalidates every token issued to the user so far; the user can still log in again
+func EndSessions(ctx context.Context, userID string) error {
+	return RDB.Incr(ctx, SessionGenerationKey(userID)).Err()
+}
@@ -0,0 +1,34 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/sachinggsingh/notify/internal/models"
+)
+
+func TestRoleFor(t *testing.T) {
+	saved := Account.AdminEmails
+	t.Cleanup(func() { Account.AdminEmails = saved })
+	Account.AdminEmails = map[string]bool{"boss@example.com": true}
+
+	email := func(s string) *string { return &s }
+	tests := []struct {
+		name string
+		user models.User
+		want string
+	}{
+		{"verified admin email", models.User{Email: email("boss@example.com"), Verified: true}, models.RoleAdmin},
+		{"admin email in other case", models.User{Email: email(" Boss@Example.com"), Verified: true}, models.RoleAdmin},
+		{"unverified admin email", models.User{Email: email("boss@example.com"), Role: models.RoleUser}, models.RoleUser},
+		{"stored admin role", models.User{Email: email("a@example.com"), Role: models.RoleAdmin}, models.RoleAdmin},
+		{"no role stored", models.User{Email: email("a@example.com"), Verified: true}, models.RoleUser},
+		{"no email", models.User{Verified: true}, models.RoleUser},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RoleFor(tt.user); got != tt.want {
+				t.Errorf("RoleFor() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
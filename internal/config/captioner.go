@@ -0,0 +1,222 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CaptionRequest is everything a Captioner needs to describe one image
+type CaptionRequest struct {
+	Prompt      string
+	ImageURL    string
+	Image       []byte // sent inline so the model sees the picture itself
+	MimeType    string
+	Temperature float64
+	MaxTokens   int
+	JSON        bool // ask the model to answer with a JSON object
+}
+
+type Captioner interface {
+	Name() string
+	Caption(ctx context.Context, req CaptionRequest) (string, error)
+}
+
+const (
+	DefaultCaptionTemperature = 0.2
+	DefaultCaptionMaxTokens   = 150
+)
+
+// DefaultCaptionPrompt is the text/template used when no prompt template is stored.
+// It can use .Uploader, .Topic, .Filename, .Locale, .URL and .ImageID.
+const DefaultCaptionPrompt = `Write a short friendly message describing the attached image{{if .Topic}} posted to "{{.Topic}}"{{end}}. ` +
+	`Keep it brief (1-2 sentences) and suitable for notifying subscribers about the new upload.` +
+	`{{if .Locale}} Write it in the language of the locale {{.Locale}}.{{end}}`
+
+var CaptionProvider Captioner
+
+// Images are scaled down to this longest edge before being sent to the model
+var CaptionMaxEdge = 1024
+
+// InitCaptioner selects the caption backend from CAPTION_PROVIDER: gemini, openai or mock.
+// When unset, gemini is used if GEMINI_API_KEY is set and the mock otherwise.
+func InitCaptioner() error {
+	if v := os.Getenv("CAPTION_MAX_DIMENSION"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return fmt.Errorf("invalid CAPTION_MAX_DIMENSION %q", v)
+		}
+		CaptionMaxEdge = n
+	}
+
+	provider := os.Getenv("CAPTION_PROVIDER")
+	if provider == "" {
+		provider = "gemini"
+		if os.Getenv("GEMINI_API_KEY") == "" {
+			log.Println("CAPTION_PROVIDER not set and GEMINI_API_KEY missing; using mock captions")
+			provider = "mock"
+		}
+	}
+
+	switch provider {
+	case "gemini":
+		g := &GeminiCaptioner{
+			APIKey:  os.Getenv("GEMINI_API_KEY"),
+			Model:   os.Getenv("GEMINI_MODEL"),
+			BaseURL: os.Getenv("GEMINI_BASE_URL"),
+		}
+		if g.APIKey == "" {
+			return errors.New("GEMINI_API_KEY is required when CAPTION_PROVIDER=gemini")
+		}
+		if g.Model == "" {
+			g.Model = "gemini-1.5-flash"
+		}
+		if g.BaseURL == "" {
+			g.BaseURL = "https://generativelanguage.googleapis.com/v1/models"
+		}
+		CaptionProvider = g
+	case "openai":
+		o := &OpenAICaptioner{
+			APIKey:  os.Getenv("OPENAI_API_KEY"),
+			Model:   os.Getenv("OPENAI_MODEL"),
+			BaseURL: os.Getenv("OPENAI_BASE_URL"),
+		}
+		if o.BaseURL == "" {
+			o.BaseURL = "https://api.openai.com/v1"
+		}
+		if o.Model == "" {
+			return errors.New("OPENAI_MODEL is required when CAPTION_PROVIDER=openai")
+		}
+		CaptionProvider = o
+	case "mock":
+		CaptionProvider = &MockCaptioner{
+			Text:  os.Getenv("CAPTION_MOCK_TEXT"),
+			Error: os.Getenv("CAPTION_MOCK_ERROR"),
+		}
+	default:
+		return fmt.Errorf("unknown CAPTION_PROVIDER %q", provider)
+	}
+	return nil
+}
+
+// MockCaptioner returns a deterministic caption derived from the request, for offline
+// development and tests. Setting Error makes every call fail with that message.
+type MockCaptioner struct {
+	Text  string
+	Error string
+}
+
+func (m *MockCaptioner) Name() string { return "mock" }
+
+func (m *MockCaptioner) Caption(ctx context.Context, req CaptionRequest) (string, error) {
+	if m.Error != "" {
+		return "", errors.New(m.Error)
+	}
+	if req.JSON {
+		return `{"tags": ["mock", "image"], "objects": ["object"], "alt_text": "An uploaded image (mock description)."}`, nil
+	}
+	if m.Text != "" {
+		return m.Text, nil
+	}
+	h := sha256.New()
+	h.Write([]byte(req.Prompt))
+	h.Write(req.Image)
+	sum := h.Sum(nil)
+	return "A new image has been shared (mock caption " + hex.EncodeToString(sum[:4]) + ").", nil
+}
+
+// ImageAnalysis is the structured description stored alongside the caption
+type ImageAnalysis struct {
+	Tags    []string `json:"tags"`
+	Objects []string `json:"objects"`
+	AltText string   `json:"alt_text"`
+}
+
+const analysisPrompt = `Describe the attached image for search and accessibility. Answer only with JSON of the form ` +
+	`{"tags": ["..."], "objects": ["..."], "alt_text": "..."}: up to 10 short lowercase tags, ` +
+	`the dominant objects in the picture, and one sentence of alt text for screen reader users.`
+
+const maxImageTags = 10
+
+// AnalyzeImage asks the model for tags, dominant objects and alt text
+func AnalyzeImage(ctx context.Context, model Captioner, image []byte, mimeType string) (ImageAnalysis, error) {
+	out, err := model.Caption(ctx, CaptionRequest{
+		Prompt:      analysisPrompt,
+		Image:       image,
+		MimeType:    mimeType,
+		Temperature: DefaultCaptionTemperature,
+		MaxTokens:   400,
+		JSON:        true,
+	})
+	if err != nil {
+		return ImageAnalysis{}, err
+	}
+
+	var a ImageAnalysis
+	if err := json.Unmarshal([]byte(extractJSON(out)), &a); err != nil {
+		return ImageAnalysis{}, fmt.Errorf("image analysis is not JSON: %q", out)
+	}
+	a.Tags = normalizeTerms(a.Tags, maxImageTags)
+	a.Objects = normalizeTerms(a.Objects, maxImageTags)
+	a.AltText = strings.TrimSpace(a.AltText)
+	return a, nil
+}
+
+// normalizeTerms lowercases, trims and de-duplicates terms, keeping at most limit
+func normalizeTerms(terms []string, limit int) []string {
+	seen := map[string]bool{}
+	out := []string{}
+	for _, t := range terms {
+		t = strings.ToLower(strings.TrimSpace(t))
+		if t == "" || seen[t] {
+			continue
+		}
+		seen[t] = true
+		out = append(out, t)
+		if len(out) == limit {
+			break
+		}
+	}
+	return out
+}
+
+var aiHTTPClient = &http.Client{Timeout: 30 * time.Second}
+
+// postJSON sends body to endpoint and decodes a successful JSON response into out
+func postJSON(ctx context.Context, endpoint string, headers map[string]string, body, out any) error {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := aiHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		var rbody bytes.Buffer
+		_, _ = rbody.ReadFrom(resp.Body)
+		return fmt.Errorf("status %d body %s", resp.StatusCode, rbody.String())
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -1,33 +1,43 @@
 package config
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
+	"encoding/base64"
 	"fmt"
-	"net/http"
-	"os"
-	"time"
+	"net/url"
 )
 
-var (
-	geminiAPIKey  = os.Getenv("GEMINI_API_KEY")
-	geminiModel   = os.Getenv("GEMINI_MODEL") //
-	geminiBaseURL = "https://generativelanguage.googleapis.com/v1/models"
-)
+// GeminiCaptioner calls the Gemini generateContent API
+type GeminiCaptioner struct {
+	APIKey  string
+	Model   string
+	BaseURL string
+}
 
 // Request format for Gemini generateContent API
+type genPart struct {
+	Text       string         `json:"text,omitempty"`
+	InlineData *genInlineData `json:"inline_data,omitempty"`
+}
+
+type genInlineData struct {
+	MimeType string `json:"mime_type"`
+	Data     string `json:"data"` // base64
+}
+
 type genRequest struct {
 	Contents []struct {
-		Role  string `json:"role"`
-		Parts []struct {
-			Text string `json:"text"`
-		} `json:"parts"`
+		Role  string    `json:"role"`
+		Parts []genPart `json:"parts"`
 	} `json:"contents"`
-	GenerationConfig *struct {
-		Temperature     float64 `json:"temperature,omitempty"`
-		MaxOutputTokens int     `json:"maxOutputTokens,omitempty"`
-	} `json:"generationConfig,omitempty"`
+	GenerationConfig *genConfig `json:"generationConfig,omitempty"`
+}
+
+type genConfig struct {
+	// A pointer so a configured temperature of 0 is sent rather than dropped
+	Temperature      *float64 `json:"temperature,omitempty"`
+	MaxOutputTokens  int      `json:"maxOutputTokens,omitempty"`
+	ResponseMimeType string   `json:"responseMimeType,omitempty"`
 }
 
 // Response format for Gemini generateContent API
@@ -41,72 +51,38 @@ type genResponse struct {
 	} `json:"candidates"`
 }
 
-func GenerateCaption(ctx context.Context, imageURL string) (string, error) {
-	if geminiAPIKey == "" {
-		return "", fmt.Errorf("GEMINI_API_KEY not set")
-	}
-	model := geminiModel
-	if model == "" {
-		model = "gemini-1.5-flash"
-	}
-	promptText := fmt.Sprintf("Write a short friendly message describing the uploaded image located at %s. Keep it brief (1-2 sentences) and suitable for notifying subscribers about the new upload.", imageURL)
-
-	reqBody := genRequest{
-		Contents: []struct {
-			Role  string `json:"role"`
-			Parts []struct {
-				Text string `json:"text"`
-			} `json:"parts"`
-		}{
-			{
-				Role: "user",
-				Parts: []struct {
-					Text string `json:"text"`
-				}{
-					{Text: promptText},
-				},
-			},
-		},
-		GenerationConfig: &struct {
-			Temperature     float64 `json:"temperature,omitempty"`
-			MaxOutputTokens int     `json:"maxOutputTokens,omitempty"`
-		}{Temperature: 0.2, MaxOutputTokens: 150},
-	}
-	b, err := json.Marshal(reqBody)
-	if err != nil {
-		return "", err
-	}
-
-	endpoint := fmt.Sprintf("%s/%s:generateContent?key=%s", geminiBaseURL, model, geminiAPIKey)
-	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(b))
-	if err != nil {
-		return "", err
-	}
-	httpReq.Header.Set("Content-Type", "application/json")
+func (g *GeminiCaptioner) Name() string { return "gemini" }
 
-	client := &http.Client{Timeout: 20 * time.Second}
-	resp, err := client.Do(httpReq)
-	if err != nil {
-		return "", err
+func (g *GeminiCaptioner) Caption(ctx context.Context, req CaptionRequest) (string, error) {
+	parts := []genPart{{Text: req.Prompt}}
+	if len(req.Image) > 0 {
+		parts = append(parts, genPart{InlineData: &genInlineData{
+			MimeType: req.MimeType,
+			Data:     base64.StdEncoding.EncodeToString(req.Image),
+		}})
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode >= 300 {
-		var rbody bytes.Buffer
-		_, _ = rbody.ReadFrom(resp.Body)
-		return "", fmt.Errorf("gemini API error: status %d body %s", resp.StatusCode, rbody.String())
+	var reqBody genRequest
+	reqBody.Contents = append(reqBody.Contents, struct {
+		Role  string    `json:"role"`
+		Parts []genPart `json:"parts"`
+	}{Role: "user", Parts: parts})
+	reqBody.GenerationConfig = &genConfig{Temperature: &req.Temperature, MaxOutputTokens: req.MaxTokens}
+	if req.JSON {
+		reqBody.GenerationConfig.ResponseMimeType = "application/json"
 	}
 
+	endpoint := fmt.Sprintf("%s/%s:generateContent?key=%s", g.BaseURL, g.Model, url.QueryEscape(g.APIKey))
 	var gr genResponse
-	if err := json.NewDecoder(resp.Body).Decode(&gr); err != nil {
-		return "", err
+	if err := postJSON(ctx, endpoint, nil, reqBody, &gr); err != nil {
+		return "", fmt.Errorf("gemini API error: %w", err)
 	}
 	if len(gr.Candidates) == 0 {
 		return "", fmt.Errorf("no candidates returned by gemini")
 	}
-	parts := gr.Candidates[0].Content.Parts
-	if len(parts) == 0 {
+	out := gr.Candidates[0].Content.Parts
+	if len(out) == 0 {
 		return "", fmt.Errorf("no parts returned by gemini")
 	}
-	return parts[0].Text, nil
+	return out[0].Text, nil
 }
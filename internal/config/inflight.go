@@ -0,0 +1,57 @@
+package config
+
+import (
+	"context"
+	"time"
+)
+
+// inflightRetention is how long a disconnected QoS 1 session keeps its unacked messages
+const inflightRetention = 24 * time.Hour
+
+// redisInflight stores unacked deliveries in a hash per session, shared by every replica
+type redisInflight struct{}
+
+func inflightKey(session string) string {
+	return "inflight:" + session
+}
+
+// DeleteUserInflight drops the unacked deliveries of every QoS 1 session of the user
+func DeleteUserInflight(ctx context.Context, userID string) error {
+	iter := RDB.Scan(ctx, 0, inflightKey(userID+":*"), 100).Iterator()
+	for iter.Next(ctx) {
+		if err := RDB.Del(ctx, iter.Val()).Err(); err != nil {
+			return err
+		}
+	}
+	return iter.Err()
+}
+
+func (redisInflight) Save(session, deliveryID string, message []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	pipe := RDB.TxPipeline()
+	pipe.HSet(ctx, inflightKey(session), deliveryID, message)
+	pipe.Expire(ctx, inflightKey(session), inflightRetention)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (redisInflight) Remove(session, deliveryID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	return RDB.HDel(ctx, inflightKey(session), deliveryID).Err()
+}
+
+func (redisInflight) Load(session string) (map[string][]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	values, err := RDB.HGetAll(ctx, inflightKey(session)).Result()
+	if err != nil {
+		return nil, err
+	}
+	pending := make(map[string][]byte, len(values))
+	for id, message := range values {
+		pending[id] = []byte(message)
+	}
+	return pending, nil
+}
@@ -0,0 +1,64 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+type JobSettings struct {
+	Concurrency       int
+	MaxAttempts       int
+	BackoffBase       time.Duration
+	BackoffMax        time.Duration
+	VisibilityTimeout time.Duration // a job not finished within this is handed to another worker
+}
+
+var Jobs = JobSettings{
+	Concurrency:       4,
+	MaxAttempts:       5,
+	BackoffBase:       5 * time.Second,
+	BackoffMax:        10 * time.Minute,
+	VisibilityTimeout: 2 * time.Minute,
+}
+
+func InitJobs() error {
+	ints := map[string]*int{
+		"JOB_CONCURRENCY":  &Jobs.Concurrency,
+		"JOB_MAX_ATTEMPTS": &Jobs.MaxAttempts,
+	}
+	for name, target := range ints {
+		if v := os.Getenv(name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 {
+				return fmt.Errorf("invalid %s %q", name, v)
+			}
+			*target = n
+		}
+	}
+	durations := map[string]*time.Duration{
+		"JOB_BACKOFF_BASE":       &Jobs.BackoffBase,
+		"JOB_BACKOFF_MAX":        &Jobs.BackoffMax,
+		"JOB_VISIBILITY_TIMEOUT": &Jobs.VisibilityTimeout,
+	}
+	for name, target := range durations {
+		if v := os.Getenv(name); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil || d <= 0 {
+				return fmt.Errorf("invalid %s %q", name, v)
+			}
+			*target = d
+		}
+	}
+	return nil
+}
+
+// Backoff returns the delay before retry number attempt (1-based): base doubled per attempt, capped at max
+func (s JobSettings) Backoff(attempt int) time.Duration {
+	d := s.BackoffBase
+	for i := 1; i < attempt && d < s.BackoffMax; i++ {
+		d *= 2
+	}
+	return min(d, s.BackoffMax)
+}
@@ -0,0 +1,107 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/smtp"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Mailer interface {
+	Send(ctx context.Context, to, subject, body string) error
+}
+
+var Mail Mailer
+
+// InitMailer selects the mail transport from MAILER: smtp, file or log (default)
+func InitMailer() error {
+	switch os.Getenv("MAILER") {
+	case "smtp":
+		m := &SMTPMailer{
+			Host:     os.Getenv("SMTP_HOST"),
+			Port:     os.Getenv("SMTP_PORT"),
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     os.Getenv("MAIL_FROM"),
+		}
+		if m.Host == "" || m.From == "" {
+			return fmt.Errorf("SMTP_HOST and MAIL_FROM are required when MAILER=smtp")
+		}
+		if m.Port == "" {
+			m.Port = "587"
+		}
+		Mail = m
+	case "file":
+		path := os.Getenv("MAILER_FILE")
+		if path == "" {
+			path = "mail.log"
+		}
+		Mail = &LogMailer{Path: path}
+	case "", "log":
+		Mail = &LogMailer{}
+	default:
+		return fmt.Errorf("unknown MAILER %q", os.Getenv("MAILER"))
+	}
+	return nil
+}
+
+type SMTPMailer struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, to, subject, body string) error {
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+	msg := "From: " + m.From + "\r\n" +
+		"To: " + to + "\r\n" +
+		"Subject: " + subject + "\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: text/plain; charset=UTF-8\r\n" +
+		"\r\n" + strings.ReplaceAll(body, "\n", "\r\n")
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- smtp.SendMail(net.JoinHostPort(m.Host, m.Port), auth, m.From, []string{to}, []byte(msg))
+	}()
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// LogMailer writes mail to the server log, or appends it to Path, for local testing
+type LogMailer struct {
+	Path string
+	mu   sync.Mutex
+}
+
+func (m *LogMailer) Send(ctx context.Context, to, subject, body string) error {
+	entry := fmt.Sprintf("--- %s\nTo: %s\nSubject: %s\n\n%s\n", time.Now().Format(time.RFC3339), to, subject, body)
+	if m.Path == "" {
+		log.Print("Mail not sent (log mailer):\n" + entry)
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f, err := os.OpenFile(m.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.WriteString(entry)
+	return err
+}
@@ -0,0 +1,154 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// ModerationRequest is content about to be broadcast: message text, an image, or both
+type ModerationRequest struct {
+	Text     string
+	Image    []byte
+	MimeType string
+}
+
+type ModerationResult struct {
+	Flagged    bool     `json:"flagged"`
+	Categories []string `json:"categories,omitempty"`
+	Reason     string   `json:"reason,omitempty"`
+}
+
+type Moderator interface {
+	Name() string
+	Moderate(ctx context.Context, req ModerationRequest) (ModerationResult, error)
+}
+
+// ContentModerator is nil when moderation is off
+var ContentModerator Moderator
+
+// ModerationFailOpen lets content through when the moderator itself fails; by default it is held for review
+var ModerationFailOpen bool
+
+// InitModerator selects the classifier from MODERATION_PROVIDER: off (default), keyword, mock or ai.
+// The ai moderator reuses the caption provider, so call it after InitCaptioner.
+func InitModerator() error {
+	ModerationFailOpen = os.Getenv("MODERATION_FAIL_OPEN") == "true"
+
+	switch provider := os.Getenv("MODERATION_PROVIDER"); provider {
+	case "", "off":
+		ContentModerator = nil
+	case "keyword":
+		m, err := NewKeywordModerator(os.Getenv("MODERATION_KEYWORDS"))
+		if err != nil {
+			return err
+		}
+		ContentModerator = m
+	case "mock":
+		marker := os.Getenv("MODERATION_MOCK_MARKER")
+		if marker == "" {
+			marker = "[flag]"
+		}
+		ContentModerator = &MockModerator{Marker: marker}
+	case "ai":
+		if CaptionProvider == nil {
+			return errors.New("MODERATION_PROVIDER=ai needs a caption provider")
+		}
+		ContentModerator = &AIModerator{Model: CaptionProvider}
+	default:
+		return fmt.Errorf("unknown MODERATION_PROVIDER %q", provider)
+	}
+	return nil
+}
+
+// KeywordModerator flags text containing any of a list of words. Images always pass.
+type KeywordModerator struct {
+	pattern *regexp.Regexp
+}
+
+func NewKeywordModerator(keywords string) (*KeywordModerator, error) {
+	var words []string
+	for _, w := range strings.Split(keywords, ",") {
+		if w = strings.TrimSpace(w); w != "" {
+			words = append(words, regexp.QuoteMeta(w))
+		}
+	}
+	if len(words) == 0 {
+		return nil, errors.New("MODERATION_KEYWORDS is required when MODERATION_PROVIDER=keyword")
+	}
+	pattern, err := regexp.Compile(`(?i)\b(` + strings.Join(words, "|") + `)\b`)
+	if err != nil {
+		return nil, err
+	}
+	return &KeywordModerator{pattern: pattern}, nil
+}
+
+func (m *KeywordModerator) Name() string { return "keyword" }
+
+func (m *KeywordModerator) Moderate(ctx context.Context, req ModerationRequest) (ModerationResult, error) {
+	if match := m.pattern.FindString(req.Text); match != "" {
+		return ModerationResult{Flagged: true, Categories: []string{"keyword"}, Reason: fmt.Sprintf("contains %q", match)}, nil
+	}
+	return ModerationResult{}, nil
+}
+
+// MockModerator flags text containing Marker, for offline development and tests
+type MockModerator struct {
+	Marker string
+}
+
+func (m *MockModerator) Name() string { return "mock" }
+
+func (m *MockModerator) Moderate(ctx context.Context, req ModerationRequest) (ModerationResult, error) {
+	if strings.Contains(req.Text, m.Marker) {
+		return ModerationResult{Flagged: true, Categories: []string{"mock"}, Reason: "contains " + m.Marker}, nil
+	}
+	return ModerationResult{}, nil
+}
+
+// AIModerator asks the configured model to classify the content and answer in JSON
+type AIModerator struct {
+	Model Captioner
+}
+
+const moderationPrompt = `You are a content moderator for a public notification feed. Decide whether the content below ` +
+	`(and the attached image, if any) is unsafe to broadcast: sexual content, violence or gore, hate or harassment, ` +
+	`self-harm, illegal activity, or personal data. Answer only with JSON of the form ` +
+	`{"flagged": true|false, "categories": ["..."], "reason": "..."}.`
+
+func (m *AIModerator) Name() string { return "ai:" + m.Model.Name() }
+
+func (m *AIModerator) Moderate(ctx context.Context, req ModerationRequest) (ModerationResult, error) {
+	prompt := moderationPrompt
+	if req.Text != "" {
+		prompt += "\n\nContent:\n" + req.Text
+	}
+	out, err := m.Model.Caption(ctx, CaptionRequest{
+		Prompt:    prompt,
+		Image:     req.Image,
+		MimeType:  req.MimeType,
+		MaxTokens: 200,
+	})
+	if err != nil {
+		return ModerationResult{}, err
+	}
+
+	var result ModerationResult
+	if err := json.Unmarshal([]byte(extractJSON(out)), &result); err != nil {
+		return ModerationResult{}, fmt.Errorf("moderation answer is not JSON: %q", out)
+	}
+	return result, nil
+}
+
+// extractJSON strips the markdown code fences models like to wrap JSON answers in
+func extractJSON(s string) string {
+	start, end := strings.Index(s, "{"), strings.LastIndex(s, "}")
+	if start < 0 || end < start {
+		return s
+	}
+	return s[start : end+1]
+}
@@ -0,0 +1,331 @@
+package config
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/sachinggsingh/notify/internal/models"
+)
+
+// OIDC is nil unless OIDC_ISSUER_URL is configured
+var OIDC *OIDCProvider
+
+type OIDCProvider struct {
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+
+	discovery  oidcDiscovery
+	httpClient *http.Client
+
+	keysMutex sync.RWMutex
+	keys      map[string]any
+
+	// refreshMutex serialises JWKS refreshes triggered by unknown key IDs; refreshedAt throttles them
+	refreshMutex sync.Mutex
+	refreshedAt  time.Time
+}
+
+// jwksRefreshInterval is the least time between JWKS refreshes caused by an unknown key ID
+const jwksRefreshInterval = time.Minute
+
+// Subset of the OpenID Provider Metadata we rely on
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type jsonWebKey struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+type tokenEndpointResponse struct {
+	AccessToken      string `json:"access_token"`
+	IDToken          string `json:"id_token"`
+	TokenType        string `json:"token_type"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+func InitOIDC() error {
+	issuer := os.Getenv("OIDC_ISSUER_URL")
+	if issuer == "" {
+		return nil
+	}
+
+	scopes := strings.Fields(os.Getenv("OIDC_SCOPES"))
+	if len(scopes) == 0 {
+		scopes = []string{"openid", "email", "profile"}
+	}
+
+	provider := &OIDCProvider{
+		IssuerURL:    strings.TrimSuffix(issuer, "/"),
+		ClientID:     os.Getenv("OIDC_CLIENT_ID"),
+		ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+		RedirectURL:  os.Getenv("OIDC_REDIRECT_URL"),
+		Scopes:       scopes,
+		httpClient:   &http.Client{Timeout: 10 * time.Second},
+		keys:         make(map[string]any),
+	}
+	if provider.ClientID == "" || provider.RedirectURL == "" {
+		return fmt.Errorf("OIDC_CLIENT_ID and OIDC_REDIRECT_URL are required when OIDC_ISSUER_URL is set")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	if err := provider.discover(ctx); err != nil {
+		return fmt.Errorf("oidc discovery: %w", err)
+	}
+	if err := provider.refreshKeys(ctx); err != nil {
+		return fmt.Errorf("oidc jwks: %w", err)
+	}
+	provider.refreshedAt = time.Now()
+
+	OIDC = provider
+	fmt.Println("OIDC provider configured:", provider.IssuerURL)
+	return nil
+}
+
+func (p *OIDCProvider) discover(ctx context.Context) error {
+	var doc oidcDiscovery
+	if err := p.getJSON(ctx, p.IssuerURL+"/.well-known/openid-configuration", &doc); err != nil {
+		return err
+	}
+	if strings.TrimSuffix(doc.Issuer, "/") != p.IssuerURL {
+		return fmt.Errorf("issuer mismatch: configured %q, discovered %q", p.IssuerURL, doc.Issuer)
+	}
+	if doc.AuthorizationEndpoint == "" || doc.TokenEndpoint == "" || doc.JWKSURI == "" {
+		return errors.New("discovery document is missing required endpoints")
+	}
+	p.discovery = doc
+	return nil
+}
+
+func (p *OIDCProvider) refreshKeys(ctx context.Context) error {
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := p.getJSON(ctx, p.discovery.JWKSURI, &set); err != nil {
+		return err
+	}
+
+	keys := make(map[string]any)
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		pub, err := k.publicKey()
+		if err != nil {
+			continue
+		}
+		keys[k.Kid] = pub
+	}
+	if len(keys) == 0 {
+		return errors.New("no usable signing keys")
+	}
+
+	p.keysMutex.Lock()
+	p.keys = keys
+	p.keysMutex.Unlock()
+	return nil
+}
+
+// refreshKeysThrottled refreshes the signing keys at most once per jwksRefreshInterval, so tokens
+// with made-up key IDs cannot make the service fetch the JWKS on every request
+func (p *OIDCProvider) refreshKeysThrottled(ctx context.Context) error {
+	p.refreshMutex.Lock()
+	defer p.refreshMutex.Unlock()
+	if time.Since(p.refreshedAt) < jwksRefreshInterval {
+		return errors.New("signing key not found and keys were refreshed recently")
+	}
+	p.refreshedAt = time.Now()
+	return p.refreshKeys(ctx)
+}
+
+func (p *OIDCProvider) getJSON(ctx context.Context, endpoint string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: status %d", endpoint, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// AuthCodeURL builds the authorization endpoint redirect using PKCE (S256). A non-empty
+// loginHint is passed on so the provider can preselect the account.
+func (p *OIDCProvider) AuthCodeURL(state, nonce, codeVerifier, loginHint string) string {
+	challenge := sha256.Sum256([]byte(codeVerifier))
+	q := url.Values{}
+	q.Set("response_type", "code")
+	q.Set("client_id", p.ClientID)
+	q.Set("redirect_uri", p.RedirectURL)
+	q.Set("scope", strings.Join(p.Scopes, " "))
+	q.Set("state", state)
+	q.Set("nonce", nonce)
+	q.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	q.Set("code_challenge_method", "S256")
+	if loginHint != "" {
+		q.Set("login_hint", loginHint)
+	}
+
+	sep := "?"
+	if strings.Contains(p.discovery.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return p.discovery.AuthorizationEndpoint + sep + q.Encode()
+}
+
+// Exchange trades an authorization code for the raw ID token
+func (p *OIDCProvider) Exchange(ctx context.Context, code, codeVerifier string) (string, error) {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.RedirectURL)
+	form.Set("code_verifier", codeVerifier)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(p.ClientID), url.QueryEscape(p.ClientSecret))
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var tr tokenEndpointResponse
+	if err := json.NewDecoder(resp.Body).Decode(&tr); err != nil {
+		return "", fmt.Errorf("decode token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK || tr.Error != "" {
+		return "", fmt.Errorf("token endpoint error: status %d %s %s", resp.StatusCode, tr.Error, tr.ErrorDescription)
+	}
+	if tr.IDToken == "" {
+		return "", errors.New("token response did not include an id_token")
+	}
+	return tr.IDToken, nil
+}
+
+// VerifyIDToken checks signature, issuer, audience, expiry and nonce of an ID token
+func (p *OIDCProvider) VerifyIDToken(ctx context.Context, rawIDToken, nonce string) (*models.IDTokenClaims, error) {
+	claims := &models.IDTokenClaims{}
+	_, err := jwt.ParseWithClaims(rawIDToken, claims, func(token *jwt.Token) (any, error) {
+		kid, _ := token.Header["kid"].(string)
+		if key := p.lookupKey(kid); key != nil {
+			return key, nil
+		}
+		// Unknown kid: the provider may have rotated its keys
+		if err := p.refreshKeysThrottled(ctx); err != nil {
+			return nil, err
+		}
+		if key := p.lookupKey(kid); key != nil {
+			return key, nil
+		}
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512"}),
+		jwt.WithIssuer(p.discovery.Issuer),
+		jwt.WithAudience(p.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(30*time.Second),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Nonce != nonce {
+		return nil, errors.New("id token nonce mismatch")
+	}
+	if claims.Subject == "" {
+		return nil, errors.New("id token has no subject")
+	}
+	return claims, nil
+}
+
+func (p *OIDCProvider) lookupKey(kid string) any {
+	p.keysMutex.RLock()
+	defer p.keysMutex.RUnlock()
+	if key, ok := p.keys[kid]; ok {
+		return key
+	}
+	// Providers with a single key sometimes omit kid from the header
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key
+		}
+	}
+	return nil
+}
+
+func (k jsonWebKey) publicKey() (any, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
@@ -0,0 +1,81 @@
+package config
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAuthCodeURLLoginHint(t *testing.T) {
+	p := &OIDCProvider{ClientID: "notify", RedirectURL: "http://localhost/cb", Scopes: []string{"openid"}}
+	p.discovery.AuthorizationEndpoint = "http://issuer/authorize"
+
+	tests := []struct {
+		hint string
+		want []string // nil when login_hint must be absent
+	}{
+		{"", nil},
+		{"jane@example.com", []string{"jane@example.com"}},
+	}
+	for _, tt := range tests {
+		u, err := url.Parse(p.AuthCodeURL("state", "nonce", "verifier", tt.hint))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := u.Query()["login_hint"]
+		if len(got) != len(tt.want) || (len(got) == 1 && got[0] != tt.want[0]) {
+			t.Errorf("hint %q: login_hint = %v, want %v", tt.hint, got, tt.want)
+		}
+	}
+}
+
+func TestRefreshKeysThrottled(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fetches atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		json.NewEncoder(w).Encode(map[string]any{"keys": []jsonWebKey{{
+			Kid: "k1",
+			Kty: "RSA",
+			N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	}))
+	defer srv.Close()
+
+	p := &OIDCProvider{httpClient: srv.Client(), keys: map[string]any{}}
+	p.discovery.JWKSURI = srv.URL
+	ctx := context.Background()
+
+	if err := p.refreshKeysThrottled(ctx); err != nil {
+		t.Fatalf("first refresh: %v", err)
+	}
+	for range 5 {
+		if err := p.refreshKeysThrottled(ctx); err == nil {
+			t.Fatal("refresh within the interval succeeded")
+		}
+	}
+	if n := fetches.Load(); n != 1 {
+		t.Fatalf("JWKS fetched %d times, want 1", n)
+	}
+
+	p.refreshedAt = time.Now().Add(-jwksRefreshInterval)
+	if err := p.refreshKeysThrottled(ctx); err != nil {
+		t.Fatalf("refresh after the interval: %v", err)
+	}
+	if n := fetches.Load(); n != 2 {
+		t.Errorf("JWKS fetched %d times, want 2", n)
+	}
+}
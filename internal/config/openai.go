@@ -0,0 +1,85 @@
+package config
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// OpenAICaptioner calls an OpenAI-compatible chat completions endpoint. Local servers
+// that speak the same API (Ollama, llama.cpp, vLLM, ...) work by pointing BaseURL at them.
+type OpenAICaptioner struct {
+	APIKey  string
+	Model   string
+	BaseURL string
+}
+
+type chatMessage struct {
+	Role    string `json:"role"`
+	Content any    `json:"content"` // a string, or []chatContent for images
+}
+
+type chatContent struct {
+	Type     string `json:"type"`
+	Text     string `json:"text,omitempty"`
+	ImageURL *struct {
+		URL string `json:"url"`
+	} `json:"image_url,omitempty"`
+}
+
+type chatRequest struct {
+	Model       string        `json:"model"`
+	Messages    []chatMessage `json:"messages"`
+	Temperature float64       `json:"temperature"`
+	MaxTokens   int           `json:"max_tokens,omitempty"`
+
+	ResponseFormat *struct {
+		Type string `json:"type"`
+	} `json:"response_format,omitempty"`
+}
+
+type chatResponse struct {
+	Choices []struct {
+		Message struct {
+			Content string `json:"content"`
+		} `json:"message"`
+	} `json:"choices"`
+}
+
+func (o *OpenAICaptioner) Name() string { return "openai" }
+
+func (o *OpenAICaptioner) Caption(ctx context.Context, req CaptionRequest) (string, error) {
+	var content any = req.Prompt
+	if len(req.Image) > 0 {
+		image := chatContent{Type: "image_url", ImageURL: &struct {
+			URL string `json:"url"`
+		}{URL: "data:" + req.MimeType + ";base64," + base64.StdEncoding.EncodeToString(req.Image)}}
+		content = []chatContent{{Type: "text", Text: req.Prompt}, image}
+	}
+
+	body := chatRequest{
+		Model:       o.Model,
+		Messages:    []chatMessage{{Role: "user", Content: content}},
+		Temperature: req.Temperature,
+		MaxTokens:   req.MaxTokens,
+	}
+	if req.JSON {
+		body.ResponseFormat = &struct {
+			Type string `json:"type"`
+		}{Type: "json_object"}
+	}
+	headers := map[string]string{}
+	if o.APIKey != "" {
+		headers["Authorization"] = "Bearer " + o.APIKey
+	}
+
+	var cr chatResponse
+	if err := postJSON(ctx, strings.TrimSuffix(o.BaseURL, "/")+"/chat/completions", headers, body, &cr); err != nil {
+		return "", fmt.Errorf("openai API error: %w", err)
+	}
+	if len(cr.Choices) == 0 || cr.Choices[0].Message.Content == "" {
+		return "", fmt.Errorf("no choices returned by %s", o.Model)
+	}
+	return strings.TrimSpace(cr.Choices[0].Message.Content), nil
+}
@@ -0,0 +1,246 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sachinggsingh/notify/internal/models"
+)
+
+// RateLimitRule is a token bucket: Burst tokens, refilled at Rate tokens per second
+type RateLimitRule struct {
+	Scope string // route, user, ip, key or client
+	Rate  float64
+	Burst int
+}
+
+type RateLimitResult struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Duration
+	RetryAfter time.Duration
+}
+
+// Rules per limiter name, overridable with RATE_LIMIT_<NAME>
+var RateLimits = map[string][]RateLimitRule{}
+
+var defaultRateLimits = map[string]string{
+	"publish": "user:60/m,ip:120/m",
+	"login":   "ip:10/m",
+	"account": "ip:5/m",
+	"upload":  "user:20/m",
+	"ws":      "client:20/s:40",
+}
+
+// Refills the bucket using Redis server time so every replica shares one clock
+var tokenBucketScript = redis.NewScript(`
+local capacity = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local cost = tonumber(ARGV[3])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) + tonumber(t[2]) / 1000000
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1])
+local ts = tonumber(state[2])
+if tokens == nil then
+  tokens = capacity
+  ts = now
+end
+tokens = math.min(capacity, tokens + math.max(0, now - ts) * rate)
+local allowed = 0
+if tokens >= cost then
+  tokens = tokens - cost
+  allowed = 1
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', tostring(now))
+redis.call('EXPIRE', KEYS[1], math.ceil(capacity / rate) + 1)
+return {allowed, tostring(tokens)}
+`)
+
+func InitRateLimits() error {
+	for name, def := range defaultRateLimits {
+		spec := os.Getenv("RATE_LIMIT_" + strings.ToUpper(name))
+		if spec == "" {
+			spec = def
+		}
+		rules, err := ParseRateLimitRules(spec)
+		if err == nil {
+			err = checkRateLimitScopes(name, rules)
+		}
+		if err != nil {
+			return fmt.Errorf("RATE_LIMIT_%s: %w", strings.ToUpper(name), err)
+		}
+		RateLimits[name] = rules
+	}
+	return nil
+}
+
+// checkRateLimitScopes rejects scopes the limiter cannot identify callers by: client is one
+// WebSocket connection, and WebSocket connections carry no API key
+func checkRateLimitScopes(name string, rules []RateLimitRule) error {
+	for _, rule := range rules {
+		if name == "ws" && rule.Scope == "key" {
+			return fmt.Errorf("scope %q is not supported for WebSocket frames", rule.Scope)
+		}
+		if name != "ws" && rule.Scope == "client" {
+			return fmt.Errorf("scope %q only applies to WebSocket frames", rule.Scope)
+		}
+	}
+	return nil
+}
+
+// ParseRateLimitRules parses "scope:count/period[:burst],..." e.g. "ip:10/m,user:5/s:20".
+// "off" disables the limiter.
+func ParseRateLimitRules(spec string) ([]RateLimitRule, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "off" || spec == "" {
+		return nil, nil
+	}
+
+	var rules []RateLimitRule
+	for _, entry := range strings.Split(spec, ",") {
+		parts := strings.Split(strings.TrimSpace(entry), ":")
+		if len(parts) < 2 || len(parts) > 3 {
+			return nil, fmt.Errorf("invalid rule %q", entry)
+		}
+		scope := parts[0]
+		switch scope {
+		case "route", "user", "ip", "key", "client":
+		default:
+			return nil, fmt.Errorf("unknown scope %q", scope)
+		}
+
+		countStr, periodStr, ok := strings.Cut(parts[1], "/")
+		if !ok {
+			return nil, fmt.Errorf("invalid rate %q", parts[1])
+		}
+		count, err := strconv.Atoi(countStr)
+		if err != nil || count <= 0 {
+			return nil, fmt.Errorf("invalid count %q", countStr)
+		}
+		period, err := parseRatePeriod(periodStr)
+		if err != nil {
+			return nil, err
+		}
+
+		burst := count
+		if len(parts) == 3 {
+			burst, err = strconv.Atoi(parts[2])
+			if err != nil || burst <= 0 {
+				return nil, fmt.Errorf("invalid burst %q", parts[2])
+			}
+		}
+
+		rules = append(rules, RateLimitRule{
+			Scope: scope,
+			Rate:  float64(count) / period.Seconds(),
+			Burst: burst,
+		})
+	}
+	return rules, nil
+}
+
+func parseRatePeriod(s string) (time.Duration, error) {
+	switch s {
+	case "s":
+		return time.Second, nil
+	case "m":
+		return time.Minute, nil
+	case "h":
+		return time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid period %q", s)
+	}
+	return d, nil
+}
+
+// Take consumes one token from the bucket stored under key
+func (r RateLimitRule) Take(ctx context.Context, key string) (RateLimitResult, error) {
+	res, err := tokenBucketScript.Run(ctx, RDB, []string{key}, r.Burst, r.Rate, 1).Slice()
+	if err != nil {
+		return RateLimitResult{Allowed: true}, err
+	}
+
+	allowed, _ := res[0].(int64)
+	tokensStr, _ := res[1].(string)
+	tokens, _ := strconv.ParseFloat(tokensStr, 64)
+
+	result := RateLimitResult{
+		Allowed:   allowed == 1,
+		Limit:     r.Burst,
+		Remaining: int(math.Floor(tokens)),
+		Reset:     time.Duration((float64(r.Burst) - tokens) / r.Rate * float64(time.Second)),
+	}
+	if !result.Allowed {
+		result.RetryAfter = time.Duration((1 - tokens) / r.Rate * float64(time.Second))
+	}
+	return result, nil
+}
+
+// frameLimiter applies every "ws" rule to a connection's inbound frames. Client rules are
+// counted in memory per connection; user, ip and route rules share a Redis bucket across
+// connections and replicas.
+type frameLimiter struct {
+	local  []*models.TokenBucket
+	shared []RateLimitRule
+	keys   []string
+}
+
+func newFrameLimiter(rules []RateLimitRule, userID, ip string) *frameLimiter {
+	l := &frameLimiter{}
+	for _, rule := range rules {
+		var id string
+		switch rule.Scope {
+		case "client":
+			l.local = append(l.local, models.NewTokenBucket(rule.Rate, rule.Burst))
+			continue
+		case "route":
+			id = "all"
+		case "user":
+			id = userID
+		case "ip":
+			id = ip
+		}
+		if id == "" {
+			continue
+		}
+		l.shared = append(l.shared, rule)
+		l.keys = append(l.keys, "ratelimit:ws:"+rule.Scope+":"+id)
+	}
+	return l
+}
+
+func (l *frameLimiter) Allow() bool {
+	for _, bucket := range l.local {
+		if !bucket.Allow() {
+			return false
+		}
+	}
+	if len(l.shared) == 0 {
+		return true
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	for i, rule := range l.shared {
+		result, err := rule.Take(ctx, l.keys[i])
+		if err != nil {
+			// Fail open like the HTTP limiter
+			log.Println("Rate limiter error:", err)
+			continue
+		}
+		if !result.Allowed {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,98 @@
+package config
+
+import (
+	"testing"
+)
+
+func TestParseRateLimitRules(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    []RateLimitRule
+		wantErr bool
+	}{
+		{spec: "off"},
+		{spec: ""},
+		{spec: "ip:10/m", want: []RateLimitRule{{Scope: "ip", Rate: 10.0 / 60, Burst: 10}}},
+		{spec: "user:5/s:20, route:100/h", want: []RateLimitRule{
+			{Scope: "user", Rate: 5, Burst: 20},
+			{Scope: "route", Rate: 100.0 / 3600, Burst: 100},
+		}},
+		{spec: "client:20/s:40", want: []RateLimitRule{{Scope: "client", Rate: 20, Burst: 40}}},
+		{spec: "tenant:1/s", wantErr: true},
+		{spec: "ip:10", wantErr: true},
+		{spec: "ip:0/s", wantErr: true},
+		{spec: "ip:-1/s", wantErr: true},
+		{spec: "ip:10/d", wantErr: true},
+		{spec: "ip:10/s:0", wantErr: true},
+		{spec: "ip:10/s:5:1", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := ParseRateLimitRules(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %+v, want %+v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("rule %d = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestCheckRateLimitScopes(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    string
+		wantErr bool
+	}{
+		{"ws", "client:20/s,user:50/s,ip:100/s,route:1000/s", false},
+		{"ws", "key:10/s", true},
+		{"publish", "user:60/m,ip:120/m,key:10/s,route:1000/m", false},
+		{"publish", "client:10/s", true},
+		{"login", "ip:10/m,client:1/s", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name+" "+tt.spec, func(t *testing.T) {
+			rules, err := ParseRateLimitRules(tt.spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := checkRateLimitScopes(tt.name, rules); (err != nil) != tt.wantErr {
+				t.Errorf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFrameLimiterAppliesEveryClientRule(t *testing.T) {
+	rules, err := ParseRateLimitRules("client:1000/s:5,client:1/h:3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := newFrameLimiter(rules, "u1", "127.0.0.1")
+	allowed := 0
+	for range 10 {
+		if l.Allow() {
+			allowed++
+		}
+	}
+	// The second, tighter rule must not be dropped
+	if allowed != 3 {
+		t.Errorf("allowed %d frames, want 3", allowed)
+	}
+}
+
+func TestFrameLimiterSkipsUnknownIdentity(t *testing.T) {
+	rules, err := ParseRateLimitRules("user:1/s,ip:1/s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l := newFrameLimiter(rules, "", ""); len(l.shared) != 0 {
+		t.Errorf("shared rules %+v for a connection without user or ip", l.shared)
+	}
+}
@@ -0,0 +1,87 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sachinggsingh/notify/internal/models"
+)
+
+// Retained messages live in one Redis hash, topic -> message JSON, shared by every replica
+const retainedKey = "retained"
+
+// RetainMessage stores data as the last value of topic
+func RetainMessage(ctx context.Context, topic string, data []byte) error {
+	return RDB.HSet(ctx, retainedKey, topic, data).Err()
+}
+
+// RetainedMessage returns the retained message of topic, or nil if there is none or it has expired
+func RetainedMessage(ctx context.Context, topic string) (*models.Message, error) {
+	data, err := RDB.HGet(ctx, retainedKey, topic).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var message models.Message
+	if err := json.Unmarshal(data, &message); err != nil {
+		return nil, err
+	}
+	if message.Expired(time.Now()) {
+		RDB.HDel(ctx, retainedKey, topic)
+		return nil, nil
+	}
+	return &message, nil
+}
+
+// Only touches the retained value when it is still the message being edited or deleted
+var replaceRetainedScript = redis.NewScript(`
+local current = redis.call('HGET', KEYS[1], ARGV[1])
+if not current then return 0 end
+local ok, message = pcall(cjson.decode, current)
+if not ok or message['id'] ~= ARGV[2] then return 0 end
+if ARGV[3] == '' then
+  redis.call('HDEL', KEYS[1], ARGV[1])
+else
+  redis.call('HSET', KEYS[1], ARGV[1], ARGV[3])
+end
+return 1
+`)
+
+// ReplaceRetained swaps the retained value of topic for data if it is the message id.
+// Empty data removes it.
+func ReplaceRetained(ctx context.Context, topic, id string, data []byte) error {
+	return replaceRetainedScript.Run(ctx, RDB, []string{retainedKey}, topic, id, data).Err()
+}
+
+type redisRetained struct{}
+
+func (redisRetained) Retained(pattern string) ([][]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	all, err := RDB.HGetAll(ctx, retainedKey).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	var messages [][]byte
+	for topic, data := range all {
+		if !models.TopicMatches(pattern, topic) {
+			continue
+		}
+		var message models.Message
+		if err := json.Unmarshal([]byte(data), &message); err != nil {
+			continue
+		}
+		if message.Expired(now) {
+			RDB.HDel(ctx, retainedKey, topic)
+			continue
+		}
+		messages = append(messages, []byte(data))
+	}
+	return messages, nil
+}
@@ -0,0 +1,21 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// RetentionInterval is how often the compactor applies message retention policies
+var RetentionInterval = 10 * time.Minute
+
+func InitRetention() error {
+	if v := os.Getenv("RETENTION_INTERVAL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("invalid RETENTION_INTERVAL %q", v)
+		}
+		RetentionInterval = d
+	}
+	return nil
+}
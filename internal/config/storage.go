@@ -0,0 +1,74 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+type StoredObject struct {
+	Key         string
+	URL         string
+	Size        int64
+	ContentType string
+}
+
+// Storage is where uploaded files live. Keys are slash-separated paths such as "images/<id>.png";
+// a driver may normalise the key, so callers must keep the Key returned by Put.
+type Storage interface {
+	Put(ctx context.Context, key string, r io.Reader, contentType string) (StoredObject, error)
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+	URL(ctx context.Context, key string) (string, error)
+}
+
+var ErrObjectNotFound = errors.New("object not found")
+
+var Store Storage
+
+// InitStorage selects the upload backend from STORAGE_DRIVER: cloudinary (default), local or s3
+func InitStorage() error {
+	switch os.Getenv("STORAGE_DRIVER") {
+	case "", "cloudinary":
+		InitCloudinary()
+		Store = &CloudinaryStorage{Folder: "notify"}
+	case "local":
+		local, err := NewLocalStorage()
+		if err != nil {
+			return err
+		}
+		Store = local
+	case "s3":
+		s3, err := NewS3Storage()
+		if err != nil {
+			return err
+		}
+		Store = s3
+	default:
+		return fmt.Errorf("unknown STORAGE_DRIVER %q", os.Getenv("STORAGE_DRIVER"))
+	}
+	return nil
+}
+
+func storageURLTTL() time.Duration {
+	if v := os.Getenv("STORAGE_URL_TTL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			return d
+		}
+	}
+	return 24 * time.Hour
+}
+
+// cleanKey rejects keys that could escape the storage root
+func cleanKey(key string) (string, error) {
+	cleaned := path.Clean("/" + strings.TrimSpace(key))[1:]
+	if cleaned == "" || cleaned != strings.TrimPrefix(key, "/") || strings.Contains(cleaned, "..") {
+		return "", fmt.Errorf("invalid storage key %q", key)
+	}
+	return cleaned, nil
+}
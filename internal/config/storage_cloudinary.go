@@ -0,0 +1,80 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/cloudinary/cloudinary-go/api/uploader"
+)
+
+type CloudinaryStorage struct {
+	Folder string
+}
+
+func (s *CloudinaryStorage) Put(ctx context.Context, key string, r io.Reader, contentType string) (StoredObject, error) {
+	// Cloudinary appends the format itself, so the public ID must not carry an extension
+	publicID := strings.TrimSuffix(key, path.Ext(key))
+	result, err := Cld.Upload.Upload(ctx, r, uploader.UploadParams{
+		PublicID: publicID,
+		Folder:   s.Folder,
+	})
+	if err != nil {
+		return StoredObject{}, err
+	}
+	if result.Error.Message != "" {
+		return StoredObject{}, fmt.Errorf("cloudinary: %s", result.Error.Message)
+	}
+	return StoredObject{
+		Key:         result.PublicID,
+		URL:         result.SecureURL,
+		Size:        int64(result.Bytes),
+		ContentType: contentType,
+	}, nil
+}
+
+func (s *CloudinaryStorage) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	url, err := s.URL(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, ErrObjectNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("cloudinary: GET %s: status %d", url, resp.StatusCode)
+	}
+	return resp.Body, nil
+}
+
+func (s *CloudinaryStorage) Delete(ctx context.Context, key string) error {
+	result, err := Cld.Upload.Destroy(ctx, uploader.DestroyParams{PublicID: key})
+	if err != nil {
+		return err
+	}
+	if result.Result == "not found" {
+		return ErrObjectNotFound
+	}
+	return nil
+}
+
+func (s *CloudinaryStorage) URL(ctx context.Context, key string) (string, error) {
+	image, err := Cld.Image(key)
+	if err != nil {
+		return "", err
+	}
+	return image.String()
+}
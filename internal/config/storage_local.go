@@ -0,0 +1,155 @@
+package config
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LocalStorage keeps files on disk and serves them through signed, expiring /files/ URLs
+type LocalStorage struct {
+	Root       string
+	BaseURL    string
+	signingKey []byte
+	urlTTL     time.Duration
+}
+
+func NewLocalStorage() (*LocalStorage, error) {
+	root := os.Getenv("STORAGE_LOCAL_DIR")
+	if root == "" {
+		root = "uploads"
+	}
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, err
+	}
+
+	key := os.Getenv("STORAGE_SIGNING_KEY")
+	if key == "" {
+		key = os.Getenv("SECRET")
+	}
+	if key == "" {
+		return nil, errors.New("STORAGE_SIGNING_KEY or SECRET is required for the local storage driver")
+	}
+
+	baseURL := os.Getenv("STORAGE_PUBLIC_URL")
+	if baseURL == "" {
+		baseURL = Account.AppBaseURL + "/files"
+	}
+
+	return &LocalStorage{
+		Root:       root,
+		BaseURL:    strings.TrimSuffix(baseURL, "/"),
+		signingKey: []byte(key),
+		urlTTL:     storageURLTTL(),
+	}, nil
+}
+
+func (s *LocalStorage) path(key string) (string, error) {
+	cleaned, err := cleanKey(key)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(s.Root, filepath.FromSlash(cleaned)), nil
+}
+
+func (s *LocalStorage) Put(ctx context.Context, key string, r io.Reader, contentType string) (StoredObject, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return StoredObject{}, err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return StoredObject{}, err
+	}
+
+	// Write to a temp file first so readers never see a partial object
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".upload-*")
+	if err != nil {
+		return StoredObject{}, err
+	}
+	size, err := io.Copy(tmp, r)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return StoredObject{}, err
+	}
+	if err := os.Rename(tmp.Name(), p); err != nil {
+		os.Remove(tmp.Name())
+		return StoredObject{}, err
+	}
+
+	cleaned, _ := cleanKey(key)
+	u, _ := s.URL(ctx, cleaned)
+	return StoredObject{Key: cleaned, URL: u, Size: size, ContentType: contentType}, nil
+}
+
+func (s *LocalStorage) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	f, err := s.Open(key)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Open returns the file for key, mapping a missing file to ErrObjectNotFound
+func (s *LocalStorage) Open(key string) (*os.File, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrObjectNotFound
+	}
+	return f, err
+}
+
+func (s *LocalStorage) Delete(ctx context.Context, key string) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return ErrObjectNotFound
+	}
+	return err
+}
+
+func (s *LocalStorage) URL(ctx context.Context, key string) (string, error) {
+	cleaned, err := cleanKey(key)
+	if err != nil {
+		return "", err
+	}
+	expires := strconv.FormatInt(time.Now().Add(s.urlTTL).Unix(), 10)
+	q := url.Values{}
+	q.Set("expires", expires)
+	q.Set("signature", s.sign(cleaned, expires))
+	return s.BaseURL + "/" + (&url.URL{Path: cleaned}).EscapedPath() + "?" + q.Encode(), nil
+}
+
+// VerifySignature checks a signed URL produced by URL
+func (s *LocalStorage) VerifySignature(key, expires, signature string) bool {
+	exp, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > exp {
+		return false
+	}
+	return hmac.Equal([]byte(signature), []byte(s.sign(key, expires)))
+}
+
+func (s *LocalStorage) sign(key, expires string) string {
+	mac := hmac.New(sha256.New, s.signingKey)
+	mac.Write([]byte(key + "\n" + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
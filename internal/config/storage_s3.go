@@ -0,0 +1,96 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// S3Storage works with AWS S3 and compatible services (MinIO, R2, Spaces, ...)
+type S3Storage struct {
+	client    *minio.Client
+	bucket    string
+	publicURL string
+	urlTTL    time.Duration
+}
+
+func NewS3Storage() (*S3Storage, error) {
+	endpoint := os.Getenv("S3_ENDPOINT")
+	if endpoint == "" {
+		endpoint = "s3.amazonaws.com"
+	}
+	bucket := os.Getenv("S3_BUCKET")
+	if bucket == "" {
+		return nil, errors.New("S3_BUCKET is required for the s3 storage driver")
+	}
+
+	client, err := minio.New(endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(os.Getenv("S3_ACCESS_KEY"), os.Getenv("S3_SECRET_KEY"), ""),
+		Secure: os.Getenv("S3_USE_SSL") != "false",
+		Region: os.Getenv("S3_REGION"),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &S3Storage{
+		client:    client,
+		bucket:    bucket,
+		publicURL: strings.TrimSuffix(os.Getenv("S3_PUBLIC_URL"), "/"),
+		urlTTL:    storageURLTTL(),
+	}, nil
+}
+
+func (s *S3Storage) Put(ctx context.Context, key string, r io.Reader, contentType string) (StoredObject, error) {
+	cleaned, err := cleanKey(key)
+	if err != nil {
+		return StoredObject{}, err
+	}
+	info, err := s.client.PutObject(ctx, s.bucket, cleaned, r, -1, minio.PutObjectOptions{ContentType: contentType})
+	if err != nil {
+		return StoredObject{}, err
+	}
+	u, err := s.URL(ctx, cleaned)
+	if err != nil {
+		return StoredObject{}, err
+	}
+	return StoredObject{Key: cleaned, URL: u, Size: info.Size, ContentType: contentType}, nil
+}
+
+func (s *S3Storage) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	obj, err := s.client.GetObject(ctx, s.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	// GetObject is lazy; Stat surfaces a missing key before the caller starts reading
+	if _, err := obj.Stat(); err != nil {
+		obj.Close()
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, ErrObjectNotFound
+		}
+		return nil, err
+	}
+	return obj, nil
+}
+
+func (s *S3Storage) Delete(ctx context.Context, key string) error {
+	return s.client.RemoveObject(ctx, s.bucket, key, minio.RemoveObjectOptions{})
+}
+
+// URL returns a public URL when S3_PUBLIC_URL is set, otherwise a presigned GET
+func (s *S3Storage) URL(ctx context.Context, key string) (string, error) {
+	if s.publicURL != "" {
+		return s.publicURL + "/" + key, nil
+	}
+	u, err := s.client.PresignedGetObject(ctx, s.bucket, key, s.urlTTL, nil)
+	if err != nil {
+		return "", err
+	}
+	return u.String(), nil
+}
@@ -0,0 +1,149 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type UploadSettings struct {
+	MaxBytes  int64
+	MaxWidth  int
+	MaxHeight int
+	// MaxPixels caps width*height, which bounds the memory a full decode takes (4 bytes a pixel)
+	MaxPixels    int64
+	AllowedTypes map[string]bool
+	Variants     []VariantSpec
+
+	// Batch and resumable uploads
+	MaxFiles      int
+	ChunkMaxBytes int64
+	SessionTTL    time.Duration
+}
+
+// VariantSpec describes a derived image: its longest edge is scaled down to MaxEdge
+// (0 keeps the original size) and it is encoded as Format (empty keeps the source format).
+type VariantSpec struct {
+	Name    string
+	MaxEdge int
+	Format  string
+}
+
+const defaultUploadVariants = "thumb:128,medium:512,webp:0:webp"
+
+var Upload = UploadSettings{
+	MaxBytes:  10 << 20,
+	MaxWidth:  8000,
+	MaxHeight: 8000,
+	MaxPixels: 4096 * 4096,
+	AllowedTypes: map[string]bool{
+		"image/jpeg": true,
+		"image/png":  true,
+		"image/gif":  true,
+		"image/webp": true,
+	},
+	MaxFiles:      10,
+	ChunkMaxBytes: 5 << 20,
+	SessionTTL:    24 * time.Hour,
+}
+
+func InitUpload() error {
+	if v := os.Getenv("UPLOAD_MAX_BYTES"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n <= 0 {
+			return fmt.Errorf("invalid UPLOAD_MAX_BYTES %q", v)
+		}
+		Upload.MaxBytes = n
+	}
+	if v := os.Getenv("UPLOAD_MAX_PIXELS"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n <= 0 {
+			return fmt.Errorf("invalid UPLOAD_MAX_PIXELS %q", v)
+		}
+		Upload.MaxPixels = n
+	}
+	if v := os.Getenv("UPLOAD_CHUNK_MAX_BYTES"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n <= 0 {
+			return fmt.Errorf("invalid UPLOAD_CHUNK_MAX_BYTES %q", v)
+		}
+		Upload.ChunkMaxBytes = n
+	}
+	if v := os.Getenv("UPLOAD_SESSION_TTL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("invalid UPLOAD_SESSION_TTL %q", v)
+		}
+		Upload.SessionTTL = d
+	}
+	for name, target := range map[string]*int{"UPLOAD_MAX_WIDTH": &Upload.MaxWidth, "UPLOAD_MAX_HEIGHT": &Upload.MaxHeight, "UPLOAD_MAX_FILES": &Upload.MaxFiles} {
+		if v := os.Getenv(name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 {
+				return fmt.Errorf("invalid %s %q", name, v)
+			}
+			*target = n
+		}
+	}
+	variants := os.Getenv("UPLOAD_VARIANTS")
+	if variants == "" {
+		variants = defaultUploadVariants
+	}
+	specs, err := ParseVariantSpecs(variants)
+	if err != nil {
+		return fmt.Errorf("UPLOAD_VARIANTS: %w", err)
+	}
+	Upload.Variants = specs
+
+	if v := os.Getenv("UPLOAD_ALLOWED_TYPES"); v != "" {
+		allowed := map[string]bool{}
+		for _, t := range strings.Split(v, ",") {
+			t = strings.TrimSpace(t)
+			if !Upload.AllowedTypes[t] {
+				return fmt.Errorf("UPLOAD_ALLOWED_TYPES: %q is not a supported image type", t)
+			}
+			allowed[t] = true
+		}
+		Upload.AllowedTypes = allowed
+	}
+	return nil
+}
+
+// ParseVariantSpecs parses "name:maxEdge[:format],..." e.g. "thumb:128,webp:0:webp". "off" disables variants.
+func ParseVariantSpecs(spec string) ([]VariantSpec, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "off" {
+		return nil, nil
+	}
+
+	var specs []VariantSpec
+	seen := map[string]bool{}
+	for _, entry := range strings.Split(spec, ",") {
+		parts := strings.Split(strings.TrimSpace(entry), ":")
+		if len(parts) < 2 || len(parts) > 3 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid variant %q", entry)
+		}
+		if seen[parts[0]] {
+			return nil, fmt.Errorf("duplicate variant %q", parts[0])
+		}
+		seen[parts[0]] = true
+
+		maxEdge, err := strconv.Atoi(parts[1])
+		if err != nil || maxEdge < 0 {
+			return nil, fmt.Errorf("invalid size in variant %q", entry)
+		}
+		v := VariantSpec{Name: parts[0], MaxEdge: maxEdge}
+		if len(parts) == 3 {
+			switch parts[2] {
+			case "jpeg", "png", "webp":
+				v.Format = parts[2]
+			default:
+				return nil, fmt.Errorf("unsupported format in variant %q", entry)
+			}
+		}
+		specs = append(specs, v)
+	}
+	return specs, nil
+}
@@ -1,7 +1,11 @@
 package config
 
 import (
+	"fmt"
 	"net/http"
+	"os"
+	"regexp"
+	"strconv"
 	"sync"
 	"time"
 
@@ -18,14 +22,52 @@ var UpgraderWs = websocket.Upgrader{
 	},
 }
 
+// WSReadLimit is the largest frame a client may send, from WS_READ_LIMIT
+var WSReadLimit int64 = models.DefaultReadLimit
+
+// Acknowledged (QoS 1) delivery: unacked messages allowed per connection and how long to wait for an ack
+var (
+	WSQoSInflight   = 32
+	WSQoSAckTimeout = 10 * time.Second
+)
+
+func InitWebsocket() error {
+	if v := os.Getenv("WS_READ_LIMIT"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n <= 0 {
+			return fmt.Errorf("invalid WS_READ_LIMIT %q", v)
+		}
+		WSReadLimit = n
+	}
+	if v := os.Getenv("WS_QOS_INFLIGHT"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return fmt.Errorf("invalid WS_QOS_INFLIGHT %q", v)
+		}
+		WSQoSInflight = n
+	}
+	if v := os.Getenv("WS_QOS_ACK_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("invalid WS_QOS_ACK_TIMEOUT %q", v)
+		}
+		WSQoSAckTimeout = d
+	}
+	return nil
+}
+
 var HubInstance = &models.Hub{
 	Clients:    make(map[*models.Client]bool),
 	Broadcast:  make(chan []byte),
 	Register:   make(chan *models.Client),
 	Unregister: make(chan *models.Client),
 	Mutex:      sync.RWMutex{},
+	Inflight:   redisInflight{},
+	Retained:   redisRetained{},
 }
 
+var qosClientIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
 func init() {
 	go HubInstance.Run()
 }
@@ -39,6 +81,15 @@ func HandleConnection() gin.HandlerFunc {
 		}
 
 		userIdStr := userId.(string)
+		// A QoS session is keyed by client_id, so it has to name the device; connections sharing
+		// one would take each other's deliveries and acks
+		qos := c.Query("qos") == "1"
+		clientID := c.Query("client_id")
+		if qos && !qosClientIDPattern.MatchString(clientID) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "qos=1 requires a client_id of up to 64 letters, digits, '-' or '_'"})
+			return
+		}
+
 		conn, err := UpgraderWs.Upgrade(c.Writer, c.Request, nil)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -46,12 +97,26 @@ func HandleConnection() gin.HandlerFunc {
 		}
 
 		client := &models.Client{
-			ID:       userIdStr,
-			UserID:   userIdStr,
-			Conn:     conn,
-			Send:     make(chan []byte, 256),
-			Hub:      HubInstance,
-			LastPing: time.Now(),
+			ID:        userIdStr,
+			UserID:    userIdStr,
+			Conn:      conn,
+			Send:      models.NewSendQueue(256),
+			Hub:       HubInstance,
+			LastPing:  time.Now(),
+			IP:        c.ClientIP(),
+			ReadLimit: WSReadLimit,
+		}
+		// ?qos=1 asks for acknowledged delivery. Unacked messages are kept per user and
+		// ?client_id= so a reconnecting client gets them back.
+		if qos {
+			client.EnableQoS(models.QoSOptions{
+				Session:    userIdStr + ":" + clientID,
+				Window:     WSQoSInflight,
+				AckTimeout: WSQoSAckTimeout,
+			})
+		}
+		if rules := RateLimits["ws"]; len(rules) > 0 {
+			client.Limiter = newFrameLimiter(rules, userIdStr, client.IP)
 		}
 		client.Hub.Register <- client
 
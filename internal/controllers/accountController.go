@@ -0,0 +1,228 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	config "github.com/sachinggsingh/notify/internal/config"
+	helper "github.com/sachinggsingh/notify/internal/helpers"
+	"github.com/sachinggsingh/notify/internal/models"
+	"github.com/sachinggsingh/notify/internal/queue"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// AccountMailJob is the queue job kind that sends verification and password reset emails
+const AccountMailJob = "account_mail"
+
+type accountMailPayload struct {
+	UserID  string `json:"user_id"`
+	Purpose string `json:"purpose"` // helper.TokenPurposeVerifyEmail or helper.TokenPurposeResetPassword
+}
+
+type emailRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type resetPasswordRequest struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required,min=8,max=24"`
+}
+
+// RequestVerification re-sends the verification email. It answers the same way
+// whether or not the address exists so it can't be used to probe accounts; the
+// email goes out from the job queue so the response time doesn't tell either.
+func RequestVerification() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		var req emailRequest
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+			return
+		}
+		if err := validate.Struct(req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var user models.User
+		if err := userCollection.FindOne(ctx, bson.M{"email": req.Email}).Decode(&user); err == nil && !user.Verified {
+			enqueueAccountMail(ctx, user.User_id, helper.TokenPurposeVerifyEmail)
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "If the account exists and is unverified, a verification email has been sent"})
+	}
+}
+
+func VerifyEmail() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		token := c.Query("token")
+		if token == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "token is required"})
+			return
+		}
+
+		userID, err := helper.ConsumeUserToken(ctx, token, helper.TokenPurposeVerifyEmail)
+		if err == helper.ErrInvalidUserToken {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify email"})
+			return
+		}
+
+		_, err = userCollection.UpdateOne(ctx, bson.M{"user_id": userID}, bson.M{
+			"$set": bson.M{"verified": true, "updated_at": time.Now()},
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify email"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Email verified successfully"})
+	}
+}
+
+// ForgotPassword emails a password reset token. Like RequestVerification it answers
+// the same way, and as fast, whether or not the account exists.
+func ForgotPassword() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		var req emailRequest
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+			return
+		}
+		if err := validate.Struct(req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var user models.User
+		if err := userCollection.FindOne(ctx, bson.M{"email": req.Email}).Decode(&user); err == nil {
+			enqueueAccountMail(ctx, user.User_id, helper.TokenPurposeResetPassword)
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "If the account exists, a password reset email has been sent"})
+	}
+}
+
+func ResetPassword() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		var req resetPasswordRequest
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+			return
+		}
+		if err := validate.Struct(req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		userID, err := helper.ConsumeUserToken(ctx, req.Token, helper.TokenPurposeResetPassword)
+		if err == helper.ErrInvalidUserToken {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+			return
+		}
+
+		hashedPassword, err := helper.HashPassword(req.Password)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+			return
+		}
+
+		// Receiving the reset link proves control of the mailbox, so also verify and unlock
+		_, err = userCollection.UpdateOne(ctx, bson.M{"user_id": userID}, bson.M{
+			"$set":   bson.M{"password": hashedPassword, "verified": true, "failed_logins": 0, "updated_at": time.Now()},
+			"$unset": bson.M{"locked_until": ""},
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+			return
+		}
+		if err := endUserSessions(ctx, userID); err != nil {
+			log.Println("Failed to end user sessions:", err)
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Password has been reset"})
+	}
+}
+
+func enqueueAccountMail(ctx context.Context, userID, purpose string) {
+	if _, err := queue.Enqueue(ctx, AccountMailJob, accountMailPayload{UserID: userID, Purpose: purpose}); err != nil {
+		log.Println("Failed to queue account email:", err)
+	}
+}
+
+// HandleAccountMailJob sends a queued verification or password reset email. A failed send is
+// retried by the queue; each attempt issues a fresh token, replacing the unused one.
+func HandleAccountMailJob(ctx context.Context, job *queue.Job) error {
+	var p accountMailPayload
+	if err := job.Decode(&p); err != nil {
+		job.Attempts = job.MaxAttempts // a malformed payload won't improve on retry
+		return err
+	}
+
+	var user models.User
+	err := userCollection.FindOne(ctx, bson.M{"user_id": p.UserID}).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return nil // deleted in the meantime
+	}
+	if err != nil {
+		return err
+	}
+
+	switch p.Purpose {
+	case helper.TokenPurposeVerifyEmail:
+		if user.Verified {
+			return nil
+		}
+		return sendVerificationEmail(ctx, user)
+	case helper.TokenPurposeResetPassword:
+		return sendPasswordResetEmail(ctx, user)
+	}
+	job.Attempts = job.MaxAttempts
+	return fmt.Errorf("unknown account email purpose %q", p.Purpose)
+}
+
+func sendVerificationEmail(ctx context.Context, user models.User) error {
+	token, err := helper.CreateUserToken(ctx, user.User_id, helper.TokenPurposeVerifyEmail, config.Account.VerificationTTL)
+	if err != nil {
+		return err
+	}
+	link := config.Account.AppBaseURL + "/user/verify?token=" + url.QueryEscape(token)
+	body := fmt.Sprintf("Welcome to Notify!\n\nPlease confirm your email address by opening this link:\n%s\n\nThe link expires in %s.", link, config.Account.VerificationTTL)
+	return config.Mail.Send(ctx, *user.Email, "Verify your email address", body)
+}
+
+func sendPasswordResetEmail(ctx context.Context, user models.User) error {
+	token, err := helper.CreateUserToken(ctx, user.User_id, helper.TokenPurposeResetPassword, config.Account.PasswordResetTTL)
+	if err != nil {
+		return err
+	}
+	body := fmt.Sprintf("A password reset was requested for your Notify account.\n\n"+
+		"Send this token with your new password to POST %s/user/password/reset:\n%s\n\n"+
+		"The token expires in %s. If you did not request a reset you can ignore this email.",
+		config.Account.AppBaseURL, token, config.Account.PasswordResetTTL)
+	return config.Mail.Send(ctx, *user.Email, "Reset your password", body)
+}
@@ -0,0 +1,118 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	config "github.com/sachinggsingh/notify/internal/config"
+	"github.com/sachinggsingh/notify/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type setUserDisabledRequest struct {
+	Disabled *bool `json:"disabled" validate:"required"`
+}
+
+// ListUsers lets admins page through users, optionally searching by email or name (?q=)
+func ListUsers() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		filter := bson.M{}
+		if q := c.Query("q"); q != "" {
+			pattern := containsIgnoreCase(q)
+			filter["$or"] = bson.A{bson.M{"email": pattern}, bson.M{"name": pattern}}
+		}
+		switch c.Query("disabled") {
+		case "true":
+			filter["disabled"] = true
+		case "false":
+			filter["disabled"] = bson.M{"$ne": true}
+		}
+
+		page, limit := pagination(c)
+		total, err := userCollection.CountDocuments(ctx, filter)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		opts := options.Find().
+			SetSort(bson.D{{Key: "created_at", Value: -1}}).
+			SetSkip((page - 1) * limit).
+			SetLimit(limit)
+		cursor, err := userCollection.Find(ctx, filter, opts)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		var users []models.User
+		if err := cursor.All(ctx, &users); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		result := make([]gin.H, 0, len(users))
+		for _, user := range users {
+			result = append(result, userProfile(user))
+		}
+		c.JSON(http.StatusOK, gin.H{"users": result, "total": total, "page": page, "limit": limit})
+	}
+}
+
+// SetUserDisabled disables or re-enables an account; disabling also ends its sessions
+func SetUserDisabled() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		var req setUserDisabledRequest
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+			return
+		}
+		if err := validate.Struct(req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		userID := c.Param("user_id")
+		if userID == c.GetString("uid") && *req.Disabled {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot disable your own account"})
+			return
+		}
+
+		var user models.User
+		err := userCollection.FindOneAndUpdate(ctx, bson.M{"user_id": userID},
+			bson.M{"$set": bson.M{"disabled": *req.Disabled, "updated_at": time.Now()}},
+			options.FindOneAndUpdate().SetReturnDocument(options.After),
+		).Decode(&user)
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if *req.Disabled {
+			revokeUserSessions(ctx, userID)
+		} else if err := config.RDB.Del(ctx, config.RevokedUserKey(userID)).Err(); err != nil {
+			log.Println("Failed to clear user revocation:", err)
+		}
+
+		c.JSON(http.StatusOK, gin.H{"user": userProfile(user)})
+	}
+}
+
+func containsIgnoreCase(q string) bson.M {
+	return bson.M{"$regex": regexp.QuoteMeta(q), "$options": "i"}
+}
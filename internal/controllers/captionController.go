@@ -0,0 +1,294 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	config "github.com/sachinggsingh/notify/internal/config"
+	helper "github.com/sachinggsingh/notify/internal/helpers"
+	"github.com/sachinggsingh/notify/internal/models"
+	"github.com/sachinggsingh/notify/internal/queue"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// CaptionJob is the queue job kind that captions an uploaded image and announces it
+const CaptionJob = "caption"
+
+const fallbackCaption = "A new file has been uploaded"
+
+type captionPayload struct {
+	ImageID string `json:"image_id"`
+	UserID  string `json:"user_id"` // put on the notification message
+}
+
+// enqueueCaption queues the caption job for a freshly stored image. If the queue is
+// unreachable the image is marked failed rather than left pending forever.
+func enqueueCaption(ctx context.Context, image *models.Image, userID string) {
+	_, err := queue.Enqueue(ctx, CaptionJob, captionPayload{ImageID: image.Image_id, UserID: userID})
+	if err == nil {
+		return
+	}
+	log.Println("Failed to queue caption job for image", image.Image_id, err)
+	image.CaptionStatus = models.CaptionFailed
+	image.CaptionError = "could not queue caption job"
+	_, _ = uploadImageCollection.UpdateOne(ctx, bson.M{"image_id": image.Image_id}, bson.M{"$set": bson.M{
+		"caption_status": image.CaptionStatus,
+		"caption_error":  image.CaptionError,
+	}})
+}
+
+// HandleCaptionJob generates the caption for an image, records the outcome on the image and
+// publishes the upload notification, or holds it for review if moderation flags it. Failed
+// attempts are retried by the queue; once the last attempt fails the notification goes out
+// with a generic caption.
+func HandleCaptionJob(ctx context.Context, job *queue.Job) error {
+	var p captionPayload
+	if err := job.Decode(&p); err != nil {
+		job.Attempts = job.MaxAttempts // a malformed payload won't improve on retry
+		return err
+	}
+
+	var image models.Image
+	err := uploadImageCollection.FindOne(ctx, bson.M{"image_id": p.ImageID}).Decode(&image)
+	if err == mongo.ErrNoDocuments {
+		return nil // deleted before we got to it
+	}
+	if err != nil {
+		return err
+	}
+	if image.CaptionStatus != models.CaptionPending {
+		if image.CaptionAnnounced != nil && !*image.CaptionAnnounced {
+			// A previous run recorded the caption but failed to announce it
+			refreshImageURLs(ctx, &image)
+			data, mimeType, _ := captionImage(ctx, image)
+			return announceCaption(ctx, job, image, p.UserID, data, mimeType)
+		}
+		return nil // a previous run finished but was not acknowledged
+	}
+
+	// Stored URLs may be signed and expired by the time the job runs
+	refreshImageURLs(ctx, &image)
+
+	data, mimeType, genErr := captionImage(ctx, image)
+	var caption, templateName string
+	if genErr == nil {
+		caption, templateName, genErr = generateCaption(ctx, image, data, mimeType)
+	}
+	image.CaptionTemplate = templateName
+	if data != nil {
+		analyzeImage(ctx, &image, data, mimeType)
+	}
+
+	if genErr != nil {
+		set := bson.M{"caption_error": genErr.Error(), "caption_attempts": job.Attempts, "caption_template": templateName}
+		addAnalysis(set, image)
+		if !job.LastAttempt() {
+			_, _ = uploadImageCollection.UpdateOne(ctx, bson.M{"image_id": image.Image_id}, bson.M{"$set": set})
+			return genErr
+		}
+		set["caption_status"] = models.CaptionFailed
+		set["caption_announced"] = false
+		if _, err := uploadImageCollection.UpdateOne(ctx, bson.M{"image_id": image.Image_id}, bson.M{"$set": set}); err != nil {
+			return err
+		}
+		image.CaptionStatus = models.CaptionFailed
+		image.CaptionError = genErr.Error()
+		return announceCaption(ctx, job, image, p.UserID, data, mimeType)
+	}
+
+	// Record the final status before announcing, so a retry after a failed publish announces
+	// again instead of generating a second caption
+	set := bson.M{
+		"caption_status":    models.CaptionDone,
+		"caption":           caption,
+		"caption_attempts":  job.Attempts,
+		"caption_template":  templateName,
+		"captioned_at":      time.Now(),
+		"caption_announced": false,
+	}
+	addAnalysis(set, image)
+	_, err = uploadImageCollection.UpdateOne(ctx, bson.M{"image_id": image.Image_id}, bson.M{
+		"$set":   set,
+		"$unset": bson.M{"caption_error": ""},
+	})
+	if err != nil {
+		return err
+	}
+	image.CaptionStatus = models.CaptionDone
+	image.Caption = caption
+	return announceCaption(ctx, job, image, p.UserID, data, mimeType)
+}
+
+// announceCaption publishes the upload message for a recorded caption status and marks it
+// announced. A failed publish is retried, except on the last attempt.
+func announceCaption(ctx context.Context, job *queue.Job, image models.Image, userID string, data []byte, mimeType string) error {
+	caption, captionErr := image.Caption, error(nil)
+	if image.CaptionStatus == models.CaptionFailed {
+		caption, captionErr = fallbackCaption, errors.New(image.CaptionError)
+	}
+	moderation, err := announceUpload(ctx, image, userID, caption, captionErr, config.ModerationRequest{Text: caption, Image: data, MimeType: mimeType})
+	if err != nil && !job.LastAttempt() {
+		return err
+	}
+	if err != nil {
+		log.Println("Failed to publish upload message for image", image.Image_id, err)
+	}
+
+	set := bson.M{"caption_announced": true}
+	if moderation != "" {
+		set["moderation_status"] = moderation
+	}
+	_, err = uploadImageCollection.UpdateOne(ctx, bson.M{"image_id": image.Image_id}, bson.M{"$set": set})
+	return err
+}
+
+// announceUpload builds the upload notification and publishes it, unless the moderator flags the
+// image or caption, in which case it goes to the review queue. A caption failure is reported in
+// the metadata next to the fallback text. It returns the moderation status to record on the image.
+func announceUpload(ctx context.Context, image models.Image, userID, caption string, captionErr error, content config.ModerationRequest) (string, error) {
+	// The message takes the image's ID, so an announcement retried after a failure is stored once
+	msg := models.Message{
+		ID:        image.ID,
+		Topic:     image.Topic,
+		UserID:    userID,
+		AuthorID:  image.OwnerID,
+		Content:   caption,
+		Timestamp: time.Now(),
+		Metadata: map[string]any{
+			"image_id":         image.Image_id,
+			"url":              image.URL,
+			"variants":         variantURLs(image.Variants),
+			"caption_provider": config.CaptionProvider.Name(),
+			"caption_status":   models.CaptionDone,
+			"caption_template": image.CaptionTemplate,
+		},
+	}
+	if len(image.Tags) > 0 {
+		msg.Metadata["tags"] = image.Tags
+	}
+	if image.AltText != "" {
+		msg.Metadata["alt_text"] = image.AltText
+	}
+	if captionErr != nil {
+		msg.Metadata["caption_status"] = models.CaptionFailed
+		msg.Metadata["caption_error"] = captionErr.Error()
+	}
+
+	if result := moderate(ctx, content); result != nil {
+		if _, err := holdForReview(ctx, models.ReviewImage, image.Image_id, msg, result); err != nil {
+			return "", err
+		}
+		return "held", nil
+	}
+	_, err := publishMessage(ctx, msg)
+	if mongo.IsDuplicateKeyError(err) {
+		err = rebroadcastStored(ctx, msg.ID)
+	}
+	if err != nil {
+		return "", err
+	}
+	if config.ContentModerator != nil {
+		return models.ReviewApproved, nil
+	}
+	return "", nil
+}
+
+// GetImageCaption reports the caption job status for an image: pending, done or failed
+func GetImageCaption() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		image, ok := findAccessibleImage(ctx, c, c.Param("image_id"))
+		if !ok {
+			return
+		}
+
+		status := image.CaptionStatus
+		if status == "" {
+			status = "unknown" // uploaded before captions were tracked
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"image_id":     image.Image_id,
+			"status":       status,
+			"caption":      image.Caption,
+			"error":        image.CaptionError,
+			"attempts":     image.CaptionAttempts,
+			"captioned_at": image.CaptionedAt,
+		})
+	}
+}
+
+// generateCaption renders the prompt template for the image and sends it with the image to the model.
+// It returns the name of the template used so it can be recorded.
+func generateCaption(ctx context.Context, image models.Image, data []byte, mimeType string) (string, string, error) {
+	prompt, tmpl, err := captionPrompt(ctx, image)
+	if err != nil {
+		return "", tmpl.Name, fmt.Errorf("prompt template %s: %w", tmpl.Name, err)
+	}
+
+	req := config.CaptionRequest{
+		Prompt:      prompt,
+		ImageURL:    image.URL,
+		Image:       data,
+		MimeType:    mimeType,
+		Temperature: config.DefaultCaptionTemperature,
+		MaxTokens:   config.DefaultCaptionMaxTokens,
+	}
+	if tmpl.Temperature != nil {
+		req.Temperature = *tmpl.Temperature
+	}
+	if tmpl.MaxTokens != nil {
+		req.MaxTokens = *tmpl.MaxTokens
+	}
+	caption, err := config.CaptionProvider.Caption(ctx, req)
+	return caption, tmpl.Name, err
+}
+
+// analyzeImage fills in tags, objects and alt text. It is best effort: a failure is logged and
+// the upload is announced without them.
+func analyzeImage(ctx context.Context, image *models.Image, data []byte, mimeType string) {
+	analysis, err := config.AnalyzeImage(ctx, config.CaptionProvider, data, mimeType)
+	if err != nil {
+		log.Println("Image analysis failed for", image.Image_id, err)
+		return
+	}
+	image.Tags = analysis.Tags
+	image.Objects = analysis.Objects
+	image.AltText = analysis.AltText
+}
+
+func addAnalysis(set bson.M, image models.Image) {
+	if len(image.Tags) > 0 {
+		set["tags"] = image.Tags
+	}
+	if len(image.Objects) > 0 {
+		set["objects"] = image.Objects
+	}
+	if image.AltText != "" {
+		set["alt_text"] = image.AltText
+	}
+}
+
+// captionImage loads the stored original and shrinks it to config.CaptionMaxEdge so the
+// model sees the picture without paying for a full-size upload
+func captionImage(ctx context.Context, image models.Image) ([]byte, string, error) {
+	r, err := config.Store.Get(ctx, image.PublicID)
+	if err != nil {
+		return nil, "", fmt.Errorf("reading image: %w", err)
+	}
+	defer r.Close()
+
+	data, err := io.ReadAll(io.LimitReader(r, config.Upload.MaxBytes+1))
+	if err != nil {
+		return nil, "", fmt.Errorf("reading image: %w", err)
+	}
+	return helper.ShrinkForModel(data, config.CaptionMaxEdge)
+}
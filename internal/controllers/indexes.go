@@ -0,0 +1,96 @@
+package controllers
+
+import (
+	"context"
+
+	helper "github.com/sachinggsingh/notify/internal/helpers"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// EnsureIndexes creates the Mongo indexes the handlers rely on
+func EnsureIndexes(ctx context.Context) error {
+	_, err := userCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "email", Value: 1}}},
+		{Keys: bson.D{{Key: "user_id", Value: 1}}},
+		{Keys: bson.D{{Key: "oidc_issuer", Value: 1}, {Key: "oidc_subject", Value: 1}}},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = uploadImageCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "image_id", Value: 1}}},
+		{Keys: bson.D{{Key: "owner_id", Value: 1}, {Key: "uploaded", Value: -1}}},
+		{Keys: bson.D{{Key: "owner_id", Value: 1}, {Key: "tags", Value: 1}}},
+		{Keys: bson.D{{Key: "alt_text", Value: "text"}, {Key: "caption", Value: "text"}, {Key: "objects", Value: "text"}}},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = uploadSessionCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "upload_id", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = uploadChunkCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "upload_id", Value: 1}, {Key: "offset", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = promptTemplateCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "name", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{
+			Keys:    bson.D{{Key: "topic", Value: 1}},
+			Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{"topic": bson.M{"$exists": true}}),
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = reviewCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "created_at", Value: 1}}},
+		{
+			Keys:    bson.D{{Key: "kind", Value: 1}, {Key: "image_id", Value: 1}},
+			Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{"image_id": bson.M{"$exists": true}}),
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = messageCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "topic", Value: 1}, {Key: "_id", Value: -1}}},
+		{Keys: bson.D{{Key: "thread_id", Value: 1}, {Key: "_id", Value: 1}}},
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = retentionCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "topic", Value: 1}}, Options: options.Index().SetUnique(true)},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = scheduledCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "deliver_at", Value: 1}}},
+		{Keys: bson.D{{Key: "owner_id", Value: 1}, {Key: "status", Value: 1}, {Key: "deliver_at", Value: 1}}},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = reactionCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "message_id", Value: 1}, {Key: "user_id", Value: 1}, {Key: "emoji", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+	})
+	if err != nil {
+		return err
+	}
+	return helper.EnsureUserTokenIndexes(ctx)
+}
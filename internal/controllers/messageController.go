@@ -0,0 +1,249 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	config "github.com/sachinggsingh/notify/internal/config"
+	"github.com/sachinggsingh/notify/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// notExpired matches stored messages that may still be replayed. The TTL index removes expired
+// messages only periodically, so reads filter them out as well.
+func notExpired(now time.Time) bson.M {
+	return bson.M{"$or": bson.A{
+		bson.M{"expires_at": bson.M{"$exists": false}},
+		bson.M{"expires_at": bson.M{"$gt": now}},
+	}}
+}
+
+// ListMessages replays stored messages, newest first. ?topic= narrows to one topic and
+// ?include_deleted=true adds tombstones of deleted messages.
+func ListMessages() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		filter := notExpired(time.Now())
+		// Deleted messages are left out unless the client asks for their tombstones
+		if c.Query("include_deleted") != "true" {
+			filter["deleted_at"] = bson.M{"$exists": false}
+		}
+		if topic, ok := c.GetQuery("topic"); ok {
+			if topic == "" {
+				filter["topic"] = bson.M{"$exists": false}
+			} else {
+				filter["topic"] = topic
+			}
+		}
+
+		page, limit := pagination(c)
+		opts := options.Find().
+			SetSort(bson.D{{Key: "_id", Value: -1}}).
+			SetSkip((page - 1) * limit).
+			SetLimit(limit)
+		cursor, err := messageCollection.Find(ctx, filter, opts)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		messages := []models.Message{}
+		if err := cursor.All(ctx, &messages); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		addReactionCounts(ctx, messages)
+		c.JSON(http.StatusOK, gin.H{"messages": messages, "page": page, "limit": limit})
+	}
+}
+
+// GetRetainedMessage serves GET /protected/topics/<name>/retained. Topic names contain slashes,
+// so the route is a catch-all and the suffix is checked here.
+func GetRetainedMessage() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		name, ok := strings.CutSuffix(strings.TrimPrefix(c.Param("path"), "/"), "/retained")
+		if !ok || name == "" {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+			return
+		}
+		if err := models.ValidateTopic(name); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		message, err := config.RetainedMessage(ctx, name)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if message == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "No retained message for this topic"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"topic": name, "message": message})
+	}
+}
+
+type messageEditRequest struct {
+	Content  *string        `json:"content" validate:"omitempty,min=1"`
+	Metadata map[string]any `json:"metadata"`
+}
+
+// findEditableMessage loads a live message the caller may change and writes the error response itself
+func findEditableMessage(ctx context.Context, c *gin.Context) (models.Message, bool) {
+	var message models.Message
+	id, err := primitive.ObjectIDFromHex(c.Param("message_id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Message not found"})
+		return message, false
+	}
+	err = messageCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&message)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Message not found"})
+		return message, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return message, false
+	}
+	if message.DeletedAt != nil {
+		c.JSON(http.StatusGone, gin.H{"error": "Message has been deleted"})
+		return message, false
+	}
+	uid := c.GetString("uid")
+	if (message.AuthorID == "" || message.AuthorID != uid) && c.GetString("role") != models.RoleAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the author or an admin can change this message"})
+		return message, false
+	}
+	return message, true
+}
+
+// EditMessage replaces a message's content and/or metadata and broadcasts message.updated
+func EditMessage() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		var req messageEditRequest
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := validate.Struct(req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if req.Content == nil && req.Metadata == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Nothing to change: send content and/or metadata"})
+			return
+		}
+
+		message, ok := findEditableMessage(ctx, c)
+		if !ok {
+			return
+		}
+
+		set := bson.M{"edited_at": time.Now()}
+		if req.Content != nil {
+			if result := moderate(ctx, config.ModerationRequest{Text: *req.Content}); result != nil {
+				c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "The new content was flagged by moderation", "categories": result.Categories})
+				return
+			}
+			set["content"] = *req.Content
+		}
+		if req.Metadata != nil {
+			set["metadata"] = req.Metadata
+		}
+
+		err := messageCollection.FindOneAndUpdate(ctx,
+			bson.M{"_id": message.ID, "deleted_at": bson.M{"$exists": false}},
+			bson.M{"$set": set},
+			options.FindOneAndUpdate().SetReturnDocument(options.After),
+		).Decode(&message)
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusGone, gin.H{"error": "Message has been deleted"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if message.Retain {
+			if data, err := json.Marshal(message); err == nil {
+				if err := config.ReplaceRetained(ctx, message.Topic, message.ID.Hex(), data); err != nil {
+					log.Println("Failed to update retained message:", err)
+				}
+			}
+		}
+		err = publishTopicEvent(ctx, "message.updated", message.Topic, message.UserID, map[string]any{
+			"message_id": message.ID.Hex(),
+			"content":    message.Content,
+			"metadata":   message.Metadata,
+			"edited_at":  message.EditedAt,
+			"edited_by":  c.GetString("uid"),
+		})
+		if err != nil {
+			log.Println("Failed to publish message.updated:", err)
+		}
+		c.JSON(http.StatusOK, gin.H{"message": message})
+	}
+}
+
+// DeleteMessage turns a message into a tombstone: its content and metadata are cleared, the document
+// stays so clients can reconcile, and message.deleted is broadcast
+func DeleteMessage() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		message, ok := findEditableMessage(ctx, c)
+		if !ok {
+			return
+		}
+
+		err := messageCollection.FindOneAndUpdate(ctx,
+			bson.M{"_id": message.ID, "deleted_at": bson.M{"$exists": false}},
+			bson.M{
+				"$set":   bson.M{"deleted_at": time.Now(), "content": ""},
+				"$unset": bson.M{"metadata": ""},
+			},
+			options.FindOneAndUpdate().SetReturnDocument(options.After),
+		).Decode(&message)
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusGone, gin.H{"error": "Message has been deleted"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if message.Retain {
+			if err := config.ReplaceRetained(ctx, message.Topic, message.ID.Hex(), nil); err != nil {
+				log.Println("Failed to drop retained message:", err)
+			}
+		}
+		err = publishTopicEvent(ctx, "message.deleted", message.Topic, message.UserID, map[string]any{
+			"message_id": message.ID.Hex(),
+			"deleted_at": message.DeletedAt,
+			"deleted_by": c.GetString("uid"),
+		})
+		if err != nil {
+			log.Println("Failed to publish message.deleted:", err)
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Message deleted", "tombstone": message})
+	}
+}
@@ -0,0 +1,216 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	config "github.com/sachinggsingh/notify/internal/config"
+	database "github.com/sachinggsingh/notify/internal/db"
+	"github.com/sachinggsingh/notify/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var reviewCollection *mongo.Collection = database.OpenCollection(database.Client, "moderation_review")
+
+type reviewDecisionRequest struct {
+	Note string `json:"note"`
+}
+
+// moderate runs the configured moderator and returns the result when the content must be held
+// for review, or nil when it may be broadcast
+func moderate(ctx context.Context, req config.ModerationRequest) *config.ModerationResult {
+	m := config.ContentModerator
+	if m == nil {
+		return nil
+	}
+	result, err := m.Moderate(ctx, req)
+	if err != nil {
+		log.Println("Moderation failed:", err)
+		if config.ModerationFailOpen {
+			return nil
+		}
+		return &config.ModerationResult{Flagged: true, Categories: []string{"moderation_error"}, Reason: err.Error()}
+	}
+	if !result.Flagged {
+		return nil
+	}
+	return &result
+}
+
+// holdForReview files flagged content in the review queue. Image reviews are keyed by image so a
+// retried caption job doesn't queue the same upload twice.
+func holdForReview(ctx context.Context, kind, imageID string, msg models.Message, result *config.ModerationResult) (models.ReviewItem, error) {
+	item := models.ReviewItem{
+		ID:         primitive.NewObjectID(),
+		Kind:       kind,
+		Status:     models.ReviewPending,
+		UserID:     msg.UserID,
+		ImageID:    imageID,
+		Message:    msg,
+		DeliverAt:  msg.DeliverAt,
+		Provider:   config.ContentModerator.Name(),
+		Categories: result.Categories,
+		Reason:     result.Reason,
+		CreatedAt:  time.Now(),
+	}
+	if kind != models.ReviewImage {
+		_, err := reviewCollection.InsertOne(ctx, item)
+		return item, err
+	}
+
+	err := reviewCollection.FindOneAndUpdate(ctx,
+		bson.M{"kind": kind, "image_id": imageID},
+		bson.M{"$setOnInsert": item},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&item)
+	return item, err
+}
+
+// ListReviews pages through the review queue, oldest first. ?status= defaults to pending; ?kind= filters.
+func ListReviews() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		filter := bson.M{"status": c.DefaultQuery("status", models.ReviewPending)}
+		if kind := c.Query("kind"); kind != "" {
+			filter["kind"] = kind
+		}
+
+		page, limit := pagination(c)
+		total, err := reviewCollection.CountDocuments(ctx, filter)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		opts := options.Find().
+			SetSort(bson.D{{Key: "created_at", Value: 1}}).
+			SetSkip((page - 1) * limit).
+			SetLimit(limit)
+		cursor, err := reviewCollection.Find(ctx, filter, opts)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		items := []models.ReviewItem{}
+		if err := cursor.All(ctx, &items); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"reviews": items, "total": total, "page": page, "limit": limit})
+	}
+}
+
+// ApproveReview broadcasts the held message
+func ApproveReview() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		item, ok := decideReview(ctx, c, models.ReviewApproved)
+		if !ok {
+			return
+		}
+
+		// A scheduled message still goes out at its time; one whose time passed during review goes now
+		var err error
+		scheduled := item.DeliverAt != nil && item.DeliverAt.After(time.Now())
+		if scheduled {
+			message := item.Message
+			message.DeliverAt = item.DeliverAt
+			owner := message.AuthorID
+			if owner == "" {
+				owner = item.UserID
+			}
+			_, err = scheduleMessage(ctx, owner, message)
+		} else {
+			_, err = publishMessage(ctx, item.Message)
+			if mongo.IsDuplicateKeyError(err) {
+				err = rebroadcastStored(ctx, item.Message.ID) // upload messages carry the image's ID
+			}
+		}
+		if err != nil {
+			// Put it back so the decision can be retried
+			_, _ = reviewCollection.UpdateOne(ctx, bson.M{"_id": item.ID}, bson.M{
+				"$set":   bson.M{"status": models.ReviewPending},
+				"$unset": bson.M{"reviewed_at": "", "reviewed_by": "", "note": ""},
+			})
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to publish message"})
+			return
+		}
+		if item.Kind == models.ReviewImage {
+			_, _ = uploadImageCollection.UpdateOne(ctx, bson.M{"image_id": item.ImageID}, bson.M{"$set": bson.M{"moderation_status": models.ReviewApproved}})
+		}
+
+		if scheduled {
+			c.JSON(http.StatusOK, gin.H{"message": "Approved and scheduled", "review": item})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Approved and published", "review": item})
+	}
+}
+
+// RejectReview drops the held message. A rejected image is deleted along with its files.
+func RejectReview() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		item, ok := decideReview(ctx, c, models.ReviewRejected)
+		if !ok {
+			return
+		}
+
+		if item.Kind == models.ReviewImage {
+			var image models.Image
+			err := uploadImageCollection.FindOneAndDelete(ctx, bson.M{"image_id": item.ImageID}).Decode(&image)
+			if err == nil {
+				deleteImageFiles(ctx, image)
+			} else if err != mongo.ErrNoDocuments {
+				log.Println("Failed to delete rejected image", item.ImageID, err)
+			}
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Rejected", "review": item})
+	}
+}
+
+// decideReview moves a pending review to status and writes the error response itself
+func decideReview(ctx context.Context, c *gin.Context, status string) (models.ReviewItem, bool) {
+	var item models.ReviewItem
+	id, err := primitive.ObjectIDFromHex(c.Param("review_id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Review not found"})
+		return item, false
+	}
+	var req reviewDecisionRequest
+	_ = c.ShouldBindJSON(&req) // the note is optional
+
+	now := time.Now()
+	err = reviewCollection.FindOneAndUpdate(ctx,
+		bson.M{"_id": id, "status": models.ReviewPending},
+		bson.M{"$set": bson.M{"status": status, "reviewed_at": now, "reviewed_by": c.GetString("uid"), "note": req.Note}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&item)
+	if err == mongo.ErrNoDocuments {
+		count, _ := reviewCollection.CountDocuments(ctx, bson.M{"_id": id})
+		if count == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Review not found"})
+		} else {
+			c.JSON(http.StatusConflict, gin.H{"error": "Review has already been decided"})
+		}
+		return item, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return item, false
+	}
+	return item, true
+}
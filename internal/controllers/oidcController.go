@@ -0,0 +1,216 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	config "github.com/sachinggsingh/notify/internal/config"
+	helper "github.com/sachinggsingh/notify/internal/helpers"
+	"github.com/sachinggsingh/notify/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const oidcStateTTL = 10 * time.Minute
+
+var errOIDCEmailConflict = errors.New("an account with this email already exists")
+
+type oidcLoginState struct {
+	Nonce        string `json:"nonce"`
+	CodeVerifier string `json:"code_verifier"`
+}
+
+// OIDCLogin redirects the browser to the configured identity provider
+func OIDCLogin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if config.OIDC == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "OIDC login is not configured"})
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		// login_hint preselects the account at the provider; the mock issuer logs in as it
+		loginHint := c.Query("login_hint")
+		if len(loginHint) > 254 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "login_hint is too long"})
+			return
+		}
+
+		state, err := helper.RandomString(24)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start login"})
+			return
+		}
+		nonce, err := helper.RandomString(24)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start login"})
+			return
+		}
+		verifier, err := helper.RandomString(32)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start login"})
+			return
+		}
+
+		// State lives in Redis so the callback can land on any replica
+		data, _ := json.Marshal(oidcLoginState{Nonce: nonce, CodeVerifier: verifier})
+		if err := config.RDB.Set(ctx, "oidc:state:"+state, data, oidcStateTTL).Err(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start login"})
+			return
+		}
+
+		c.Redirect(http.StatusFound, config.OIDC.AuthCodeURL(state, nonce, verifier, loginHint))
+	}
+}
+
+// OIDCCallback completes the authorization code flow and issues the service's own tokens
+func OIDCCallback() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if config.OIDC == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "OIDC login is not configured"})
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		if providerErr := c.Query("error"); providerErr != "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": providerErr, "description": c.Query("error_description")})
+			return
+		}
+
+		state := c.Query("state")
+		code := c.Query("code")
+		if state == "" || code == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "state and code are required"})
+			return
+		}
+
+		raw, err := config.RDB.GetDel(ctx, "oidc:state:"+state).Result()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired login state"})
+			return
+		}
+		var loginState oidcLoginState
+		if err := json.Unmarshal([]byte(raw), &loginState); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired login state"})
+			return
+		}
+
+		rawIDToken, err := config.OIDC.Exchange(ctx, code, loginState.CodeVerifier)
+		if err != nil {
+			log.Println("OIDC code exchange failed:", err)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Failed to exchange authorization code"})
+			return
+		}
+
+		claims, err := config.OIDC.VerifyIDToken(ctx, rawIDToken, loginState.Nonce)
+		if err != nil {
+			log.Println("OIDC id token rejected:", err)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid ID token"})
+			return
+		}
+
+		user, err := provisionOIDCUser(ctx, claims)
+		if err == errOIDCEmailConflict {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			log.Println("OIDC provisioning failed:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to provision user"})
+			return
+		}
+		if user.Disabled {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Account is disabled"})
+			return
+		}
+
+		session, err := config.SessionGeneration(ctx, user.User_id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			return
+		}
+		tokenResponse := helper.GenerateToken(*user.Email, user.User_id, config.RoleFor(user), session)
+		if tokenResponse.Err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			return
+		}
+		if updated := helper.UpdateToken(tokenResponse.Token, tokenResponse.RefreshToken, user.User_id); updated.Err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			return
+		}
+		c.JSON(http.StatusOK, tokenResponse)
+	}
+}
+
+// provisionOIDCUser finds the user linked to the ID token subject, links an existing
+// account with the same verified email, or creates a new one just in time.
+//
+// An unverified local account may have been registered by someone else who knew the address,
+// so linking one drops its password and ends its sessions before the provider's user gets in.
+func provisionOIDCUser(ctx context.Context, claims *models.IDTokenClaims) (models.User, error) {
+	issuer := claims.Issuer
+
+	var user models.User
+	err := userCollection.FindOne(ctx, bson.M{"oidc_issuer": issuer, "oidc_subject": claims.Subject}).Decode(&user)
+	if err == nil {
+		return user, nil
+	}
+	if err != mongo.ErrNoDocuments {
+		return user, err
+	}
+
+	email := strings.ToLower(strings.TrimSpace(claims.Email))
+	if email == "" {
+		email = claims.Subject + "@" + strings.TrimPrefix(strings.TrimPrefix(issuer, "https://"), "http://")
+	}
+
+	err = userCollection.FindOne(ctx, bson.M{"email": email}).Decode(&user)
+	if err == nil {
+		// Only link to an existing account when the provider vouches for the address
+		if !claims.EmailVerified {
+			return user, errOIDCEmailConflict
+		}
+		update := bson.M{
+			"$set": bson.M{"oidc_issuer": issuer, "oidc_subject": claims.Subject, "verified": true, "updated_at": time.Now()},
+		}
+		if !user.Verified {
+			update["$set"].(bson.M)["failed_logins"] = 0
+			update["$unset"] = bson.M{"password": "", "token": "", "refresh_token": "", "locked_until": ""}
+		}
+		_, err = userCollection.UpdateOne(ctx, bson.M{"user_id": user.User_id}, update)
+		if err != nil || user.Verified {
+			user.Verified = true
+			return user, err
+		}
+		user.Verified, user.Password = true, nil
+		return user, endUserSessions(ctx, user.User_id)
+	}
+	if err != mongo.ErrNoDocuments {
+		return user, err
+	}
+
+	now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	user = models.User{
+		ID:          primitive.NewObjectID(),
+		Email:       &email,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+		OIDCIssuer:  issuer,
+		OIDCSubject: claims.Subject,
+		Verified:    claims.EmailVerified,
+		Role:        models.RoleUser,
+	}
+	user.User_id = user.ID.Hex()
+
+	_, err = userCollection.InsertOne(ctx, user)
+	return user, err
+}
@@ -0,0 +1,25 @@
+package controllers
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+const maxPageSize = 100
+
+// pagination reads ?page= and ?limit= (1-based page, default 20 per page)
+func pagination(c *gin.Context) (page int64, limit int64) {
+	page, err := strconv.ParseInt(c.DefaultQuery("page", "1"), 10, 64)
+	if err != nil || page < 1 {
+		page = 1
+	}
+	limit, err = strconv.ParseInt(c.DefaultQuery("limit", "20"), 10, 64)
+	if err != nil || limit < 1 {
+		limit = 20
+	}
+	if limit > maxPageSize {
+		limit = maxPageSize
+	}
+	return page, limit
+}
@@ -0,0 +1,334 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	config "github.com/sachinggsingh/notify/internal/config"
+	helper "github.com/sachinggsingh/notify/internal/helpers"
+	"github.com/sachinggsingh/notify/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type updateProfileRequest struct {
+	Name  *string `json:"name" validate:"omitempty,max=100"`
+	Email *string `json:"email" validate:"omitempty,email"`
+}
+
+type changePasswordRequest struct {
+	CurrentPassword string `json:"current_password" validate:"required"`
+	NewPassword     string `json:"new_password" validate:"required,min=8,max=24"`
+}
+
+type deleteAccountRequest struct {
+	Password string `json:"password"`
+}
+
+// userProfile is the public view of a user; it never includes password hashes or tokens
+func userProfile(user models.User) gin.H {
+	return gin.H{
+		"id":         user.ID,
+		"user_id":    user.User_id,
+		"email":      user.Email,
+		"name":       user.Name,
+		"role":       config.RoleFor(user),
+		"verified":   user.Verified,
+		"disabled":   user.Disabled,
+		"sso":        user.OIDCSubject != "",
+		"created_at": user.CreatedAt,
+		"updated_at": user.UpdatedAt,
+	}
+}
+
+func GetProfile() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		var user models.User
+		err := userCollection.FindOne(ctx, bson.M{"user_id": c.GetString("uid")}).Decode(&user)
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"user": userProfile(user)})
+	}
+}
+
+func UpdateProfile() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		var req updateProfileRequest
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+			return
+		}
+		if err := validate.Struct(req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		userID := c.GetString("uid")
+		var user models.User
+		if err := userCollection.FindOne(ctx, bson.M{"user_id": userID}).Decode(&user); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+			return
+		}
+
+		set := bson.M{"updated_at": time.Now()}
+		emailChanged := false
+		if req.Name != nil {
+			set["name"] = strings.TrimSpace(*req.Name)
+		}
+		if req.Email != nil && *req.Email != *user.Email {
+			// Admin addresses are reserved; otherwise verifying one would hand out admin
+			if config.IsAdminEmail(*req.Email) && c.GetString("role") != models.RoleAdmin {
+				c.JSON(http.StatusForbidden, gin.H{"error": "This email address is reserved"})
+				return
+			}
+			count, err := userCollection.CountDocuments(ctx, bson.M{"email": *req.Email})
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while checking existing email"})
+				return
+			}
+			if count > 0 {
+				c.JSON(http.StatusConflict, gin.H{"error": "Email already exists"})
+				return
+			}
+			set["email"] = *req.Email
+			set["verified"] = false
+			emailChanged = true
+		}
+
+		err := userCollection.FindOneAndUpdate(ctx, bson.M{"user_id": userID}, bson.M{"$set": set},
+			options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&user)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update profile"})
+			return
+		}
+
+		if emailChanged {
+			if err := sendVerificationEmail(ctx, user); err != nil {
+				log.Println("Failed to send verification email:", err)
+			}
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Profile updated", "user": userProfile(user)})
+	}
+}
+
+func ChangePassword() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		var req changePasswordRequest
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+			return
+		}
+		if err := validate.Struct(req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		userID := c.GetString("uid")
+		var user models.User
+		if err := userCollection.FindOne(ctx, bson.M{"user_id": userID}).Decode(&user); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+			return
+		}
+		if user.Password == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "account signs in through SSO and has no password"})
+			return
+		}
+		if ok, msg := helper.VerifyPassword(*user.Password, req.CurrentPassword); !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": msg})
+			return
+		}
+
+		hashedPassword, err := helper.HashPassword(req.NewPassword)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+			return
+		}
+		_, err = userCollection.UpdateOne(ctx, bson.M{"user_id": userID}, bson.M{
+			"$set": bson.M{"password": hashedPassword, "updated_at": time.Now()},
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change password"})
+			return
+		}
+		// Whoever knew the old password may still hold a token
+		if err := endUserSessions(ctx, userID); err != nil {
+			log.Println("Failed to end user sessions:", err)
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Password changed, please log in again"})
+	}
+}
+
+// DeleteAccount removes the user together with their messages and images and
+// closes their WebSocket connections on every replica.
+func DeleteAccount() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+		defer cancel()
+
+		var req deleteAccountRequest
+		_ = c.ShouldBindJSON(&req)
+
+		userID := c.GetString("uid")
+		var user models.User
+		if err := userCollection.FindOne(ctx, bson.M{"user_id": userID}).Decode(&user); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+			return
+		}
+		if user.Password != nil {
+			if ok, msg := helper.VerifyPassword(*user.Password, req.Password); !ok {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": msg})
+				return
+			}
+		}
+
+		if err := deleteUserData(ctx, userID); err != nil {
+			log.Println("Failed to delete user data:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete account"})
+			return
+		}
+		if _, err := userCollection.DeleteOne(ctx, bson.M{"user_id": userID}); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete account"})
+			return
+		}
+
+		revokeUserSessions(ctx, userID)
+		c.JSON(http.StatusOK, gin.H{"message": "Account deleted"})
+	}
+}
+
+func deleteUserData(ctx context.Context, userID string) error {
+	cursor, err := uploadImageCollection.Find(ctx, bson.M{"owner_id": userID})
+	if err != nil {
+		return err
+	}
+	var images []models.Image
+	if err := cursor.All(ctx, &images); err != nil {
+		return err
+	}
+	imageIDs := make([]string, len(images))
+	for i, image := range images {
+		imageIDs[i] = image.Image_id
+		deleteImageFiles(ctx, image)
+	}
+
+	if _, err := uploadImageCollection.DeleteMany(ctx, bson.M{"owner_id": userID}); err != nil {
+		return err
+	}
+	if err := deleteUserMessages(ctx, userID, imageIDs); err != nil {
+		return err
+	}
+	if _, err := reactionCollection.DeleteMany(ctx, bson.M{"user_id": userID}); err != nil {
+		return err
+	}
+	if _, err := scheduledCollection.DeleteMany(ctx, bson.M{"owner_id": userID}); err != nil {
+		return err
+	}
+	if _, err := reviewCollection.DeleteMany(ctx, bson.M{"$or": []bson.M{{"user_id": userID}, {"message.author_id": userID}}}); err != nil {
+		return err
+	}
+	if err := deleteUserUploadSessions(ctx, userID); err != nil {
+		return err
+	}
+	if err := config.DeleteUserInflight(ctx, userID); err != nil {
+		return err
+	}
+	return helper.DeleteUserTokens(ctx, userID)
+}
+
+// deleteUserUploadSessions drops the user's unfinished resumable uploads and their chunks
+func deleteUserUploadSessions(ctx context.Context, userID string) error {
+	uploadIDs, err := uploadSessionCollection.Distinct(ctx, "upload_id", bson.M{"owner_id": userID})
+	if err != nil {
+		return err
+	}
+	if len(uploadIDs) > 0 {
+		if _, err := uploadChunkCollection.DeleteMany(ctx, bson.M{"upload_id": bson.M{"$in": uploadIDs}}); err != nil {
+			return err
+		}
+	}
+	_, err = uploadSessionCollection.DeleteMany(ctx, bson.M{"owner_id": userID})
+	return err
+}
+
+// deleteUserMessages removes the messages a user authored, the reactions on them and any topic
+// value they retain. Messages from before authors were recorded only carry the userid field,
+// and older upload announcements are found through the image they announce.
+func deleteUserMessages(ctx context.Context, userID string, imageIDs []string) error {
+	filter := bson.M{"$or": []bson.M{
+		{"author_id": userID},
+		{"author_id": bson.M{"$exists": false}, "userid": userID},
+		{"metadata.image_id": bson.M{"$in": imageIDs}},
+	}}
+	cursor, err := messageCollection.Find(ctx, filter, options.Find().SetProjection(bson.M{"_id": 1, "topic": 1, "retain": 1}))
+	if err != nil {
+		return err
+	}
+	var messages []models.Message
+	if err := cursor.All(ctx, &messages); err != nil {
+		return err
+	}
+	if len(messages) == 0 {
+		return nil
+	}
+
+	ids := make([]primitive.ObjectID, len(messages))
+	for i, message := range messages {
+		ids[i] = message.ID
+		if message.Retain && message.Topic != "" {
+			if err := config.ReplaceRetained(ctx, message.Topic, message.ID.Hex(), nil); err != nil {
+				log.Println("Failed to drop retained message:", err)
+			}
+		}
+	}
+	if _, err := reactionCollection.DeleteMany(ctx, bson.M{"message_id": bson.M{"$in": ids}}); err != nil {
+		return err
+	}
+	_, err = messageCollection.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	return err
+}
+
+// endUserSessions invalidates the user's outstanding tokens and drops their live connections,
+// but unlike revokeUserSessions lets the user log in again
+func endUserSessions(ctx context.Context, userID string) error {
+	if err := config.EndSessions(ctx, userID); err != nil {
+		return err
+	}
+	if err := disconnectUserEverywhere(ctx, userID); err != nil {
+		log.Println("Failed to disconnect user:", err)
+	}
+	return nil
+}
+
+// revokeUserSessions rejects the user's outstanding tokens and drops their live connections
+func revokeUserSessions(ctx context.Context, userID string) {
+	if err := config.RDB.Set(ctx, config.RevokedUserKey(userID), 1, helper.TokenLifetime).Err(); err != nil {
+		log.Println("Failed to revoke user tokens:", err)
+	}
+	if err := disconnectUserEverywhere(ctx, userID); err != nil {
+		log.Println("Failed to disconnect user:", err)
+	}
+}
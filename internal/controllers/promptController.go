@@ -0,0 +1,187 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	config "github.com/sachinggsingh/notify/internal/config"
+	database "github.com/sachinggsingh/notify/internal/db"
+	"github.com/sachinggsingh/notify/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var promptTemplateCollection *mongo.Collection = database.OpenCollection(database.Client, "prompt_template")
+
+const defaultPromptName = "default"
+
+// promptVars are the variables available to caption prompt templates
+type promptVars struct {
+	Uploader string
+	Topic    string
+	Filename string
+	Locale   string
+	URL      string
+	ImageID  string
+}
+
+// captionPrompt picks the template for the image's topic, falling back to the stored "default"
+// template and then the built-in prompt, and renders it together with its generation settings
+func captionPrompt(ctx context.Context, image models.Image) (string, models.PromptTemplate, error) {
+	tmpl := models.PromptTemplate{Name: "builtin", Template: config.DefaultCaptionPrompt}
+
+	filters := []bson.M{{"name": defaultPromptName}}
+	if image.Topic != "" {
+		filters = append([]bson.M{{"topic": image.Topic}}, filters...)
+	}
+	for _, filter := range filters {
+		var stored models.PromptTemplate
+		err := promptTemplateCollection.FindOne(ctx, filter).Decode(&stored)
+		if err == nil {
+			tmpl = stored
+			break
+		}
+		if err != mongo.ErrNoDocuments {
+			return "", tmpl, err
+		}
+	}
+
+	vars := promptVars{
+		Uploader: uploaderName(ctx, image.OwnerID),
+		Topic:    image.Topic,
+		Filename: image.Filename,
+		Locale:   image.CaptionLocale,
+		URL:      image.URL,
+		ImageID:  image.Image_id,
+	}
+	prompt, err := renderPrompt(tmpl.Template, vars)
+	return prompt, tmpl, err
+}
+
+func renderPrompt(text string, vars promptVars) (string, error) {
+	t, err := template.New("prompt").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	if err := t.Execute(&b, vars); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(b.String()), nil
+}
+
+func uploaderName(ctx context.Context, userID string) string {
+	var user models.User
+	if err := userCollection.FindOne(ctx, bson.M{"user_id": userID}).Decode(&user); err != nil {
+		return ""
+	}
+	if user.Name != "" {
+		return user.Name
+	}
+	if user.Email != nil {
+		return *user.Email
+	}
+	return ""
+}
+
+// ListPromptTemplates returns every stored caption prompt template
+func ListPromptTemplates() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		cursor, err := promptTemplateCollection.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "name", Value: 1}}))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		templates := []models.PromptTemplate{}
+		if err := cursor.All(ctx, &templates); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"templates": templates, "builtin": config.DefaultCaptionPrompt})
+	}
+}
+
+func GetPromptTemplate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		var tmpl models.PromptTemplate
+		err := promptTemplateCollection.FindOne(ctx, bson.M{"name": c.Param("name")}).Decode(&tmpl)
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Prompt template not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"template": tmpl})
+	}
+}
+
+// PutPromptTemplate creates or replaces a template. The template is rendered against sample
+// values first so a broken template is rejected instead of failing caption jobs later.
+func PutPromptTemplate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		var tmpl models.PromptTemplate
+		if err := c.BindJSON(&tmpl); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := validate.Struct(tmpl); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		sample := promptVars{Uploader: "Ada", Topic: "photos", Filename: "cat.jpg", Locale: "en", URL: "https://example.com/cat.jpg", ImageID: "0"}
+		preview, err := renderPrompt(tmpl.Template, sample)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid template: " + err.Error()})
+			return
+		}
+
+		tmpl.Name = c.Param("name")
+		tmpl.UpdatedAt = time.Now()
+		tmpl.UpdatedBy = c.GetString("uid")
+		_, err = promptTemplateCollection.ReplaceOne(ctx, bson.M{"name": tmpl.Name}, tmpl, options.Replace().SetUpsert(true))
+		if mongo.IsDuplicateKeyError(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Another template is already assigned to topic " + tmpl.Topic})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"template": tmpl, "preview": preview})
+	}
+}
+
+func DeletePromptTemplate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		res, err := promptTemplateCollection.DeleteOne(ctx, bson.M{"name": c.Param("name")})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if res.DeletedCount == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Prompt template not found"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Prompt template deleted"})
+	}
+}
@@ -3,6 +3,8 @@ package controllers
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"time"
@@ -13,6 +15,7 @@ import (
 	database "github.com/sachinggsingh/notify/internal/db"
 	"github.com/sachinggsingh/notify/internal/models"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
@@ -30,58 +33,343 @@ func PublishMessage() gin.HandlerFunc {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
+		// Like WebSocket publishes, messages are always published as the caller; subscriber
+		// filters and per-user rate limits rely on user_id
+		message.UserID = c.GetString("uid")
 
-		validationErr := validate.Struct(message)
-		if validationErr != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+		if err := validateMessage(&message); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
-
-		result, err := messageCollection.InsertOne(ctx, message)
-		if err != nil {
+		if err := resolveReply(ctx, &message); errors.Is(err, errInvalidReply) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		} else if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to publish message"})
 			return
 		}
 
-		data, err := json.Marshal(message)
+		outcome, err := submitMessage(ctx, c.GetString("uid"), message)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to marshal message"})
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to publish message"})
 			return
 		}
-
-		err = config.RDB.Publish(ctx, "message", data).Err()
-		if err != nil {
-			log.Println("Redis publish error:", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to publish message"})
+		if outcome.Review != nil {
+			c.JSON(http.StatusAccepted, gin.H{
+				"message":   "Message held for review",
+				"review_id": outcome.Review.ID,
+			})
+			return
+		}
+		if outcome.Scheduled != nil {
+			c.JSON(http.StatusAccepted, gin.H{
+				"message":    "Message scheduled",
+				"id":         outcome.Scheduled.ID,
+				"deliver_at": outcome.Scheduled.DeliverAt,
+			})
 			return
 		}
 
 		c.JSON(http.StatusOK, bson.M{
 			"message": "Message published successfully",
-			"result":  result,
+			"result":  outcome.Result,
 		})
 	}
 }
 
-// StartRedisSubscriber runs a background subscriber to persist messages
+// PublishFromClient handles a publish frame from a WebSocket client. The message goes through the
+// same checks as PublishMessage and is always published as the connected user.
+func PublishFromClient(client *models.Client, frame models.ClientFrame) models.ServerFrame {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	ack := models.ServerFrame{Type: "puback", ID: frame.ID}
+	fail := func(code, msg string) models.ServerFrame {
+		ack.Code, ack.Error = code, msg
+		return ack
+	}
+
+	if !publishAllowed(ctx, client) {
+		return fail("rate_limited", "Rate limit exceeded")
+	}
+
+	var message models.Message
+	if len(frame.Message) == 0 {
+		return fail("invalid_message", "message is required")
+	}
+	if err := json.Unmarshal(frame.Message, &message); err != nil {
+		return fail("invalid_message", err.Error())
+	}
+	message.UserID = client.UserID
+	if message.Timestamp.IsZero() {
+		message.Timestamp = time.Now()
+	}
+	if err := validateMessage(&message); err != nil {
+		return fail("validation_error", err.Error())
+	}
+	if err := resolveReply(ctx, &message); errors.Is(err, errInvalidReply) {
+		return fail("validation_error", err.Error())
+	} else if err != nil {
+		return fail("internal_error", "Failed to publish message")
+	}
+
+	outcome, err := submitMessage(ctx, client.UserID, message)
+	if err != nil {
+		return fail("internal_error", "Failed to publish message")
+	}
+	switch {
+	case outcome.Review != nil:
+		ack.Status, ack.ReviewID = "held", outcome.Review.ID.Hex()
+	case outcome.Scheduled != nil:
+		ack.Status, ack.MessageID = "scheduled", outcome.Scheduled.ID.Hex()
+	default:
+		ack.Status = "published"
+		if id, ok := outcome.Result.InsertedID.(primitive.ObjectID); ok {
+			ack.MessageID = id.Hex()
+		}
+	}
+	return ack
+}
+
+// maxScheduleAhead is how far in the future a message may be scheduled
+const maxScheduleAhead = 365 * 24 * time.Hour
+
+// validateMessage checks a submitted message and resolves delay into deliver_at and ttl into
+// expires_at. A ttl counts from the delivery time. IDs and event types are always set by the server.
+func validateMessage(message *models.Message) error {
+	if err := validate.Struct(message); err != nil {
+		return err
+	}
+	if err := models.ValidateTopic(message.Topic); err != nil {
+		return err
+	}
+	if message.Retain && message.Topic == "" {
+		return errors.New("retained messages need a topic")
+	}
+	message.ClearServerFields()
+
+	now := time.Now()
+	if message.Delay > 0 && message.DeliverAt == nil {
+		deliverAt := now.Add(time.Duration(message.Delay) * time.Second)
+		message.DeliverAt = &deliverAt
+	}
+	message.Delay = 0
+	if message.DeliverAt != nil && !message.DeliverAt.After(now) {
+		message.DeliverAt = nil // due already, so publish now
+	}
+	deliverAt := now
+	if message.DeliverAt != nil {
+		if message.DeliverAt.Sub(now) > maxScheduleAhead {
+			return errors.New("deliver_at is too far in the future")
+		}
+		deliverAt = *message.DeliverAt
+	}
+
+	if message.TTL > 0 && message.ExpiresAt == nil {
+		expiresAt := deliverAt.Add(time.Duration(message.TTL) * time.Second)
+		message.ExpiresAt = &expiresAt
+	}
+	message.TTL = 0
+	if message.Expired(deliverAt) {
+		return errors.New("message expires before it would be delivered")
+	}
+	return nil
+}
+
+var errInvalidReply = errors.New("invalid reply_to")
+
+// resolveReply links a reply into its thread. A reply goes to the topic of the message it
+// answers, and every reply in a thread points at the thread's first message.
+func resolveReply(ctx context.Context, message *models.Message) error {
+	if message.ReplyTo.IsZero() {
+		return nil
+	}
+	var parent models.Message
+	err := messageCollection.FindOne(ctx, bson.M{"_id": message.ReplyTo}).Decode(&parent)
+	if err == mongo.ErrNoDocuments {
+		return fmt.Errorf("%w: message not found", errInvalidReply)
+	}
+	if err != nil {
+		return err
+	}
+	if parent.DeletedAt != nil {
+		return fmt.Errorf("%w: message has been deleted", errInvalidReply)
+	}
+	if message.Topic == "" {
+		message.Topic = parent.Topic
+	} else if message.Topic != parent.Topic {
+		return fmt.Errorf("%w: a reply must stay on topic %q", errInvalidReply, parent.Topic)
+	}
+	message.ThreadID = parent.ThreadID
+	if message.ThreadID.IsZero() {
+		message.ThreadID = parent.ID
+	}
+	return nil
+}
+
+// publishOutcome says what became of a submitted message; exactly one field is set
+type publishOutcome struct {
+	Result    *mongo.InsertOneResult
+	Review    *models.ReviewItem
+	Scheduled *models.ScheduledMessage
+}
+
+// submitMessage moderates a validated message, then publishes it, schedules it or holds it for review
+func submitMessage(ctx context.Context, ownerID string, message models.Message) (publishOutcome, error) {
+	message.AuthorID = ownerID
+	if result := moderate(ctx, config.ModerationRequest{Text: message.Content}); result != nil {
+		item, err := holdForReview(ctx, models.ReviewMessage, "", message, result)
+		if err != nil {
+			return publishOutcome{}, err
+		}
+		return publishOutcome{Review: &item}, nil
+	}
+	if message.DeliverAt != nil {
+		scheduled, err := scheduleMessage(ctx, ownerID, message)
+		if err != nil {
+			return publishOutcome{}, err
+		}
+		return publishOutcome{Scheduled: &scheduled}, nil
+	}
+	result, err := publishMessage(ctx, message)
+	return publishOutcome{Result: result}, err
+}
+
+// publishAllowed applies the "publish" rate limits that guard POST /protected/publish
+func publishAllowed(ctx context.Context, client *models.Client) bool {
+	for _, rule := range config.RateLimits["publish"] {
+		var id string
+		switch rule.Scope {
+		case "route":
+			id = "all"
+		case "user":
+			id = client.UserID
+		case "ip":
+			id = client.IP
+		}
+		if id == "" {
+			continue
+		}
+		result, err := rule.Take(ctx, "ratelimit:publish:"+rule.Scope+":"+id)
+		if err != nil {
+			log.Println("Rate limiter error:", err)
+			continue
+		}
+		if !result.Allowed {
+			return false
+		}
+	}
+	return true
+}
+
+// publishMessage stores a message and publishes it to Redis so every replica broadcasts it
+func publishMessage(ctx context.Context, message models.Message) (*mongo.InsertOneResult, error) {
+	if message.ID.IsZero() {
+		message.ID = primitive.NewObjectID()
+	}
+	result, err := messageCollection.InsertOne(ctx, message)
+	if err != nil {
+		return nil, err
+	}
+	if err := broadcastMessage(ctx, message); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// broadcastMessage sends a stored message to subscribers, retaining it first if asked
+func broadcastMessage(ctx context.Context, message models.Message) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	// Retain first so a client subscribing meanwhile gets it one way or the other
+	if message.Retain {
+		if err := config.RetainMessage(ctx, message.Topic, data); err != nil {
+			log.Println("Failed to retain message:", err)
+		}
+	}
+
+	if err := config.RDB.Publish(ctx, "message", data).Err(); err != nil {
+		log.Println("Redis publish error:", err)
+		return err
+	}
+
+	if !message.ThreadID.IsZero() {
+		replies, _ := messageCollection.CountDocuments(ctx, bson.M{"thread_id": message.ThreadID, "deleted_at": bson.M{"$exists": false}})
+		err := publishTopicEvent(ctx, "message.replied", message.Topic, message.UserID, map[string]any{
+			"message_id": message.ReplyTo.Hex(),
+			"thread_id":  message.ThreadID.Hex(),
+			"reply_id":   message.ID.Hex(),
+			"replies":    replies,
+		})
+		if err != nil {
+			log.Println("Failed to publish message.replied:", err)
+		}
+	}
+	return nil
+}
+
+// rebroadcastStored broadcasts the stored copy of a message whose publish was retried after the
+// insert succeeded, so edits and deletes made since win. Subscribers may see it twice if the
+// earlier broadcast did go out.
+func rebroadcastStored(ctx context.Context, id primitive.ObjectID) error {
+	var message models.Message
+	err := messageCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&message)
+	if err == mongo.ErrNoDocuments {
+		return nil // removed by retention or expiry in the meantime
+	}
+	if err != nil {
+		return err
+	}
+	if message.DeletedAt != nil || message.Expired(time.Now()) {
+		return nil
+	}
+	return broadcastMessage(ctx, message)
+}
+
+// publishEvent broadcasts a system event such as "image.deleted". Events are not stored as messages.
+func publishEvent(ctx context.Context, eventType string, userID string, metadata map[string]any) error {
+	return publishTopicEvent(ctx, eventType, "", userID, metadata)
+}
+
+// publishTopicEvent broadcasts an event on topic, so it reaches the subscribers of that topic
+func publishTopicEvent(ctx context.Context, eventType, topic, userID string, metadata map[string]any) error {
+	data, err := json.Marshal(models.Message{
+		Type:      eventType,
+		Topic:     topic,
+		UserID:    userID,
+		Content:   eventType,
+		Timestamp: time.Now(),
+		Metadata:  metadata,
+	})
+	if err != nil {
+		return err
+	}
+	return config.RDB.Publish(ctx, "message", data).Err()
+}
+
+// StartRedisSubscriber fans messages published by any replica out to this replica's WebSocket clients.
+// Publishers persist messages before publishing them, so nothing is stored here.
 func StartRedisSubscriber(ctx context.Context) {
-	sub := config.RDB.Subscribe(ctx, "message")
+	sub := config.RDB.Subscribe(ctx, "message", "control")
 	ch := sub.Channel()
 	for msg := range ch {
+		if msg.Channel == "control" {
+			handleControlEvent(msg.Payload)
+			continue
+		}
+
 		var message models.Message
 		if err := json.Unmarshal([]byte(msg.Payload), &message); err != nil {
 			log.Println("Failed to unmarshal message:", err)
 			continue
 		}
-		// Save to MongoDB
-		saveCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-		_, err := messageCollection.InsertOne(saveCtx, message)
-		cancel()
-		if err != nil {
-			log.Println("Failed to insert message:", err)
+		if message.Expired(time.Now()) {
 			continue
 		}
-		log.Println("Message received and saved:", message)
+		log.Println("Message received:", message)
 
 		// Broadcast to all connected WebSocket clients
 		if b, err := json.Marshal(message); err == nil {
@@ -91,3 +379,24 @@ func StartRedisSubscriber(ctx context.Context) {
 		}
 	}
 }
+
+func handleControlEvent(payload string) {
+	var event models.ControlEvent
+	if err := json.Unmarshal([]byte(payload), &event); err != nil {
+		log.Println("Failed to unmarshal control event:", err)
+		return
+	}
+	switch event.Type {
+	case "disconnect":
+		config.HubInstance.DisconnectUser(event.UserID)
+	}
+}
+
+// disconnectUserEverywhere closes the user's WebSocket connections on every replica
+func disconnectUserEverywhere(ctx context.Context, userID string) error {
+	data, err := json.Marshal(models.ControlEvent{Type: "disconnect", UserID: userID})
+	if err != nil {
+		return err
+	}
+	return config.RDB.Publish(ctx, "control", data).Err()
+}
@@ -0,0 +1,289 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	database "github.com/sachinggsingh/notify/internal/db"
+	"github.com/sachinggsingh/notify/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var reactionCollection *mongo.Collection = database.OpenCollection(database.Client, "message_reaction")
+
+const maxEmojiRunes = 16
+
+// GetThread returns the thread a message belongs to: its first message and the replies, oldest first
+func GetThread() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		message, ok := findMessage(ctx, c)
+		if !ok {
+			return
+		}
+		rootID := message.ThreadID
+		if rootID.IsZero() {
+			rootID = message.ID
+		}
+
+		var root models.Message
+		if err := messageCollection.FindOne(ctx, bson.M{"_id": rootID}).Decode(&root); err != nil && err != mongo.ErrNoDocuments {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		// Tombstones stay in the thread so replies to deleted messages keep their place
+		filter := notExpired(time.Now())
+		filter["thread_id"] = rootID
+		page, limit := pagination(c)
+		total, err := messageCollection.CountDocuments(ctx, filter)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		opts := options.Find().
+			SetSort(bson.D{{Key: "_id", Value: 1}}).
+			SetSkip((page - 1) * limit).
+			SetLimit(limit)
+		cursor, err := messageCollection.Find(ctx, filter, opts)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		replies := []models.Message{}
+		if err := cursor.All(ctx, &replies); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		all := append([]models.Message{root}, replies...)
+		addReactionCounts(ctx, all)
+		response := gin.H{"replies": all[1:], "total": total, "page": page, "limit": limit}
+		if !root.ID.IsZero() {
+			response["root"] = all[0]
+		}
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+// ListReactions returns a message's reaction counts and the caller's own reactions
+func ListReactions() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		message, ok := findMessage(ctx, c)
+		if !ok {
+			return
+		}
+		counts, err := reactionCounts(ctx, message.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		mine, err := reactionCollection.Distinct(ctx, "emoji", bson.M{"message_id": message.ID, "user_id": c.GetString("uid")})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message_id": message.ID, "reactions": counts, "mine": mine})
+	}
+}
+
+// AddReaction records the caller's emoji on a message; adding it twice changes nothing
+func AddReaction() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		emoji, ok := reactionEmoji(c)
+		if !ok {
+			return
+		}
+		message, ok := findMessage(ctx, c)
+		if !ok {
+			return
+		}
+		if message.DeletedAt != nil {
+			c.JSON(http.StatusGone, gin.H{"error": "Message has been deleted"})
+			return
+		}
+
+		reaction := models.Reaction{MessageID: message.ID, UserID: c.GetString("uid"), Emoji: emoji, CreatedAt: time.Now()}
+		res, err := reactionCollection.UpdateOne(ctx,
+			bson.M{"message_id": reaction.MessageID, "user_id": reaction.UserID, "emoji": reaction.Emoji},
+			bson.M{"$setOnInsert": reaction},
+			options.Update().SetUpsert(true),
+		)
+		if err != nil && !mongo.IsDuplicateKeyError(err) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		added := err == nil && res.UpsertedCount > 0
+		counts := announceReaction(ctx, message, reaction, added, "added")
+		status := http.StatusOK
+		if added {
+			status = http.StatusCreated
+		}
+		c.JSON(status, gin.H{"message_id": message.ID, "emoji": emoji, "reactions": counts})
+	}
+}
+
+// RemoveReaction takes back the caller's emoji
+func RemoveReaction() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		emoji, ok := reactionEmoji(c)
+		if !ok {
+			return
+		}
+		message, ok := findMessage(ctx, c)
+		if !ok {
+			return
+		}
+
+		reaction := models.Reaction{MessageID: message.ID, UserID: c.GetString("uid"), Emoji: emoji}
+		res, err := reactionCollection.DeleteOne(ctx, bson.M{"message_id": reaction.MessageID, "user_id": reaction.UserID, "emoji": reaction.Emoji})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if res.DeletedCount == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Reaction not found"})
+			return
+		}
+		counts := announceReaction(ctx, message, reaction, true, "removed")
+		c.JSON(http.StatusOK, gin.H{"message_id": message.ID, "emoji": emoji, "reactions": counts})
+	}
+}
+
+// findMessage loads the message named in the URL and writes the error response itself
+func findMessage(ctx context.Context, c *gin.Context) (models.Message, bool) {
+	var message models.Message
+	id, err := primitive.ObjectIDFromHex(c.Param("message_id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Message not found"})
+		return message, false
+	}
+	err = messageCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&message)
+	if err == mongo.ErrNoDocuments || (err == nil && message.Expired(time.Now())) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Message not found"})
+		return message, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return message, false
+	}
+	return message, true
+}
+
+// reactionEmoji reads the :emoji path segment: a short string without spaces
+func reactionEmoji(c *gin.Context) (string, bool) {
+	emoji := c.Param("emoji")
+	if emoji == "" || utf8.RuneCountInString(emoji) > maxEmojiRunes || strings.ContainsFunc(emoji, unicode.IsSpace) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid emoji"})
+		return "", false
+	}
+	return emoji, true
+}
+
+// announceReaction broadcasts message.reaction with the new counts when something changed, and
+// returns the counts
+func announceReaction(ctx context.Context, message models.Message, reaction models.Reaction, changed bool, action string) map[string]int64 {
+	counts, err := reactionCounts(ctx, message.ID)
+	if err != nil {
+		log.Println("Failed to count reactions:", err)
+		return nil
+	}
+	if !changed {
+		return counts
+	}
+	err = publishTopicEvent(ctx, "message.reaction", message.Topic, reaction.UserID, map[string]any{
+		"message_id": message.ID.Hex(),
+		"emoji":      reaction.Emoji,
+		"action":     action,
+		"reactions":  counts,
+	})
+	if err != nil {
+		log.Println("Failed to publish message.reaction:", err)
+	}
+	return counts
+}
+
+func reactionCounts(ctx context.Context, messageID primitive.ObjectID) (map[string]int64, error) {
+	all, err := reactionCountsFor(ctx, []primitive.ObjectID{messageID})
+	if err != nil {
+		return nil, err
+	}
+	if counts := all[messageID]; counts != nil {
+		return counts, nil
+	}
+	return map[string]int64{}, nil
+}
+
+// reactionCountsFor counts reactions per emoji for several messages in one query
+func reactionCountsFor(ctx context.Context, ids []primitive.ObjectID) (map[primitive.ObjectID]map[string]int64, error) {
+	cursor, err := reactionCollection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"message_id": bson.M{"$in": ids}}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":   bson.M{"message_id": "$message_id", "emoji": "$emoji"},
+			"count": bson.M{"$sum": 1},
+		}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var rows []struct {
+		ID struct {
+			MessageID primitive.ObjectID `bson:"message_id"`
+			Emoji     string             `bson:"emoji"`
+		} `bson:"_id"`
+		Count int64 `bson:"count"`
+	}
+	if err := cursor.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+	counts := make(map[primitive.ObjectID]map[string]int64)
+	for _, row := range rows {
+		if counts[row.ID.MessageID] == nil {
+			counts[row.ID.MessageID] = make(map[string]int64)
+		}
+		counts[row.ID.MessageID][row.ID.Emoji] = row.Count
+	}
+	return counts, nil
+}
+
+// addReactionCounts fills in Reactions on messages read back from Mongo. Counts are best effort.
+func addReactionCounts(ctx context.Context, messages []models.Message) {
+	ids := make([]primitive.ObjectID, 0, len(messages))
+	for _, m := range messages {
+		if !m.ID.IsZero() {
+			ids = append(ids, m.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return
+	}
+	counts, err := reactionCountsFor(ctx, ids)
+	if err != nil {
+		log.Println("Failed to count reactions:", err)
+		return
+	}
+	for i := range messages {
+		messages[i].Reactions = counts[messages[i].ID]
+	}
+}
@@ -0,0 +1,427 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	config "github.com/sachinggsingh/notify/internal/config"
+	database "github.com/sachinggsingh/notify/internal/db"
+	helper "github.com/sachinggsingh/notify/internal/helpers"
+	"github.com/sachinggsingh/notify/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Resumable uploads follow the tus core protocol: create a session, PATCH chunks at the
+// current Upload-Offset, HEAD to find where to resume, then finalize to run the normal
+// upload pipeline. Chunks live in Mongo until finalize and expire with the session.
+
+var uploadSessionCollection *mongo.Collection = database.OpenCollection(database.Client, "upload_session")
+var uploadChunkCollection *mongo.Collection = database.OpenCollection(database.Client, "upload_chunk")
+
+const (
+	tusVersion = "1.0.0"
+	// A finalize claim older than this belongs to a request that died and may be retried
+	uploadFinalizeTimeout = 5 * time.Minute
+)
+
+func CreateResumableUpload() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		var req struct {
+			Filename string `json:"filename"`
+			Size     int64  `json:"size" validate:"required,gt=0"`
+			PublicID string `json:"public_id"`
+			Topic    string `json:"topic"`
+			Locale   string `json:"locale"`
+		}
+		if err := c.BindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := validate.Struct(req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := models.ValidateTopic(req.Topic); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"code": "invalid_topic", "error": err.Error()})
+			return
+		}
+		if uploadErr := validatePublicID(req.PublicID); uploadErr != nil {
+			c.JSON(uploadErr.Status, uploadErr)
+			return
+		}
+		if req.Size > config.Upload.MaxBytes {
+			uploadErr := helper.FileTooLarge()
+			c.JSON(uploadErr.Status, uploadErr)
+			return
+		}
+
+		uploadID, err := helper.RandomString(16)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create upload"})
+			return
+		}
+
+		now := time.Now()
+		session := models.UploadSession{
+			UploadID:  uploadID,
+			OwnerID:   c.GetString("uid"),
+			Filename:  req.Filename,
+			PublicID:  req.PublicID,
+			Topic:     req.Topic,
+			Locale:    req.Locale,
+			Size:      req.Size,
+			Status:    models.UploadPending,
+			CreatedAt: now,
+			UpdatedAt: now,
+			ExpiresAt: now.Add(config.Upload.SessionTTL),
+		}
+		if _, err := uploadSessionCollection.InsertOne(ctx, session); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create upload"})
+			return
+		}
+
+		setUploadHeaders(c, session)
+		c.Header("Location", "/protected/uploads/resumable/"+session.UploadID)
+		c.JSON(http.StatusCreated, gin.H{"upload": session, "chunk_max_bytes": config.Upload.ChunkMaxBytes})
+	}
+}
+
+// ResumableUploadStatus answers HEAD with offset headers only and GET with the session as JSON
+func ResumableUploadStatus() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		session, ok := findUploadSession(ctx, c)
+		if !ok {
+			return
+		}
+
+		setUploadHeaders(c, session)
+		c.Header("Cache-Control", "no-store")
+		if c.Request.Method == http.MethodHead {
+			c.Status(http.StatusOK)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"upload": session})
+	}
+}
+
+// PatchResumableUpload appends one chunk. The Upload-Offset header must match the stored
+// offset, so a client that lost a response simply asks HEAD for the offset and retries.
+func PatchResumableUpload() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+		defer cancel()
+
+		if c.ContentType() != "application/offset+octet-stream" {
+			c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "Content-Type must be application/offset+octet-stream"})
+			return
+		}
+		offset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+		if err != nil || offset < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "A valid Upload-Offset header is required"})
+			return
+		}
+
+		session, ok := findUploadSession(ctx, c)
+		if !ok {
+			return
+		}
+		if session.Status != models.UploadPending {
+			c.JSON(http.StatusConflict, gin.H{"error": "Upload is " + session.Status})
+			return
+		}
+		if offset != session.Offset {
+			setUploadHeaders(c, session)
+			c.JSON(http.StatusConflict, gin.H{"error": "Upload-Offset does not match the current offset", "offset": session.Offset})
+			return
+		}
+
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, config.Upload.ChunkMaxBytes)
+		data, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Chunk exceeds the maximum chunk size", "chunk_max_bytes": config.Upload.ChunkMaxBytes})
+				return
+			}
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read chunk"})
+			return
+		}
+		if len(data) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Chunk is empty"})
+			return
+		}
+		newOffset := offset + int64(len(data))
+		if newOffset > session.Size {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Chunk extends past the declared upload size"})
+			return
+		}
+
+		// Claim the range first by advancing the offset, so of two concurrent requests at the same
+		// offset only the one whose chunk is stored gets through
+		expiresAt := time.Now().Add(config.Upload.SessionTTL)
+		res, err := uploadSessionCollection.UpdateOne(ctx,
+			bson.M{"upload_id": session.UploadID, "offset": offset, "status": models.UploadPending},
+			bson.M{"$set": bson.M{"offset": newOffset, "updated_at": time.Now(), "expires_at": expiresAt}},
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update upload"})
+			return
+		}
+		if res.MatchedCount == 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "Upload was modified concurrently; check the offset and retry"})
+			return
+		}
+
+		// A chunk left at this offset by an earlier failed attempt is overwritten
+		_, err = uploadChunkCollection.ReplaceOne(ctx,
+			bson.M{"upload_id": session.UploadID, "offset": offset},
+			models.UploadChunk{UploadID: session.UploadID, Offset: offset, Data: data, ExpiresAt: expiresAt},
+			options.Replace().SetUpsert(true),
+		)
+		if err != nil {
+			// Give the range back; if that fails too, finalize finds the gap and rewinds
+			_, _ = uploadSessionCollection.UpdateOne(ctx,
+				bson.M{"upload_id": session.UploadID, "offset": newOffset, "status": models.UploadPending},
+				bson.M{"$set": bson.M{"offset": offset, "updated_at": time.Now()}},
+			)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store chunk"})
+			return
+		}
+		// Keep earlier chunks alive as long as the session
+		_, _ = uploadChunkCollection.UpdateMany(ctx, bson.M{"upload_id": session.UploadID}, bson.M{"$set": bson.M{"expires_at": expiresAt}})
+
+		session.Offset = newOffset
+		session.ExpiresAt = expiresAt
+		setUploadHeaders(c, session)
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// FinalizeResumableUpload assembles the chunks and runs them through the same pipeline as
+// UploadFile. Finalizing a completed upload again returns the image it produced.
+func FinalizeResumableUpload() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+		defer cancel()
+
+		session, ok := findUploadSession(ctx, c)
+		if !ok {
+			return
+		}
+		if session.Status == models.UploadCompleted {
+			finalizedUploadResponse(ctx, c, session)
+			return
+		}
+		if session.Offset != session.Size {
+			setUploadHeaders(c, session)
+			c.JSON(http.StatusConflict, gin.H{"error": "Upload is incomplete", "offset": session.Offset, "size": session.Size})
+			return
+		}
+
+		// Claim the session so two finalize calls can't store the image twice. A claim older than
+		// uploadFinalizeTimeout belongs to a finalize that died and can be taken over.
+		now := time.Now()
+		res, err := uploadSessionCollection.UpdateOne(ctx,
+			bson.M{"upload_id": session.UploadID, "offset": session.Size, "$or": bson.A{
+				bson.M{"status": models.UploadPending},
+				bson.M{"status": models.UploadFinalizing, "updated_at": bson.M{"$lt": now.Add(-uploadFinalizeTimeout)}},
+			}},
+			bson.M{"$set": bson.M{"status": models.UploadFinalizing, "updated_at": now}},
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update upload"})
+			return
+		}
+		if res.MatchedCount == 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "Upload is already being finalized"})
+			return
+		}
+
+		data, err := assembleUploadChunks(ctx, session)
+		var gap *uploadGapError
+		if errors.As(err, &gap) {
+			// Chunks went missing after their range was claimed; have the client resend from there
+			rewindUploadSession(ctx, session.UploadID, gap.Offset)
+			session.Offset = gap.Offset
+			setUploadHeaders(c, session)
+			c.JSON(http.StatusConflict, gin.H{"error": "Upload is incomplete", "offset": gap.Offset, "size": session.Size})
+			return
+		}
+		if err != nil {
+			releaseUploadSession(ctx, session.UploadID)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		imageDoc, uploadErr := storeUpload(ctx, uploadRequest{
+			OwnerID:  session.OwnerID,
+			UserID:   session.OwnerID,
+			PublicID: session.PublicID,
+			Filename: session.Filename,
+			Topic:    session.Topic,
+			Locale:   session.Locale,
+			Data:     data,
+		})
+		if uploadErr != nil {
+			releaseUploadSession(ctx, session.UploadID)
+			c.JSON(uploadErr.Status, uploadErr)
+			return
+		}
+
+		_, err = uploadSessionCollection.UpdateOne(ctx, bson.M{"upload_id": session.UploadID}, bson.M{"$set": bson.M{
+			"status":     models.UploadCompleted,
+			"image_id":   imageDoc.Image_id,
+			"updated_at": time.Now(),
+		}})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update upload"})
+			return
+		}
+		_, _ = uploadChunkCollection.DeleteMany(ctx, bson.M{"upload_id": session.UploadID})
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": "File uploaded successfully",
+			"data":    uploadResponseData(imageDoc),
+		})
+	}
+}
+
+// AbortResumableUpload discards the session and any chunks received so far
+func AbortResumableUpload() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		session, ok := findUploadSession(ctx, c)
+		if !ok {
+			return
+		}
+		if session.Status == models.UploadFinalizing && time.Since(session.UpdatedAt) < uploadFinalizeTimeout {
+			c.JSON(http.StatusConflict, gin.H{"error": "Upload is being finalized"})
+			return
+		}
+
+		if _, err := uploadChunkCollection.DeleteMany(ctx, bson.M{"upload_id": session.UploadID}); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete upload"})
+			return
+		}
+		if _, err := uploadSessionCollection.DeleteOne(ctx, bson.M{"upload_id": session.UploadID}); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete upload"})
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// findUploadSession loads the caller's session from the :upload_id param and writes the error response itself
+func findUploadSession(ctx context.Context, c *gin.Context) (models.UploadSession, bool) {
+	var session models.UploadSession
+	err := uploadSessionCollection.FindOne(ctx, bson.M{"upload_id": c.Param("upload_id")}).Decode(&session)
+	if err == mongo.ErrNoDocuments || (err == nil && session.OwnerID != c.GetString("uid")) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Upload not found"})
+		return session, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return session, false
+	}
+	return session, true
+}
+
+func setUploadHeaders(c *gin.Context, session models.UploadSession) {
+	c.Header("Tus-Resumable", tusVersion)
+	c.Header("Upload-Offset", strconv.FormatInt(session.Offset, 10))
+	c.Header("Upload-Length", strconv.FormatInt(session.Size, 10))
+	c.Header("Upload-Expires", session.ExpiresAt.UTC().Format(http.TimeFormat))
+}
+
+func assembleUploadChunks(ctx context.Context, session models.UploadSession) ([]byte, error) {
+	cursor, err := uploadChunkCollection.Find(ctx,
+		bson.M{"upload_id": session.UploadID},
+		options.Find().SetSort(bson.D{{Key: "offset", Value: 1}}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	buf := bytes.NewBuffer(make([]byte, 0, session.Size))
+	for cursor.Next(ctx) {
+		var chunk models.UploadChunk
+		if err := cursor.Decode(&chunk); err != nil {
+			return nil, err
+		}
+		if chunk.Offset != int64(buf.Len()) {
+			return nil, &uploadGapError{Offset: int64(buf.Len())}
+		}
+		buf.Write(chunk.Data)
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+	if int64(buf.Len()) != session.Size {
+		return nil, &uploadGapError{Offset: int64(buf.Len())}
+	}
+	return buf.Bytes(), nil
+}
+
+// uploadGapError reports that the stored chunks stop being contiguous at Offset
+type uploadGapError struct {
+	Offset int64
+}
+
+func (e *uploadGapError) Error() string {
+	return fmt.Sprintf("upload chunks are missing from offset %d", e.Offset)
+}
+
+// rewindUploadSession moves a session being finalized back to pending at offset. The chunks after
+// it are dropped first, while the finalize claim still keeps PATCH out, so resent bytes cannot
+// overlap them.
+func rewindUploadSession(ctx context.Context, uploadID string, offset int64) {
+	_, _ = uploadChunkCollection.DeleteMany(ctx, bson.M{"upload_id": uploadID, "offset": bson.M{"$gte": offset}})
+	_, _ = uploadSessionCollection.UpdateOne(ctx,
+		bson.M{"upload_id": uploadID, "status": models.UploadFinalizing},
+		bson.M{"$set": bson.M{"status": models.UploadPending, "offset": offset, "updated_at": time.Now()}},
+	)
+}
+
+// releaseUploadSession puts a session back to pending after a failed finalize so it can be retried or aborted
+func releaseUploadSession(ctx context.Context, uploadID string) {
+	_, _ = uploadSessionCollection.UpdateOne(ctx,
+		bson.M{"upload_id": uploadID, "status": models.UploadFinalizing},
+		bson.M{"$set": bson.M{"status": models.UploadPending, "updated_at": time.Now()}},
+	)
+}
+
+func finalizedUploadResponse(ctx context.Context, c *gin.Context, session models.UploadSession) {
+	var image models.Image
+	err := uploadImageCollection.FindOne(ctx, bson.M{"image_id": session.ImageID}).Decode(&image)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusGone, gin.H{"error": "The uploaded image has since been deleted"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	refreshImageURLs(ctx, &image)
+	c.JSON(http.StatusOK, gin.H{
+		"message": "File uploaded successfully",
+		"data":    uploadResponseData(image),
+	})
+}
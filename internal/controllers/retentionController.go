@@ -0,0 +1,253 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	config "github.com/sachinggsingh/notify/internal/config"
+	database "github.com/sachinggsingh/notify/internal/db"
+	"github.com/sachinggsingh/notify/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var retentionCollection *mongo.Collection = database.OpenCollection(database.Client, "retention_policy")
+
+func ListRetentionPolicies() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		cursor, err := retentionCollection.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "topic", Value: 1}}))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		policies := []models.RetentionPolicy{}
+		if err := cursor.All(ctx, &policies); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"policies": policies})
+	}
+}
+
+// PutRetentionPolicy creates or replaces the policy for the topic in the body
+func PutRetentionPolicy() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		var policy models.RetentionPolicy
+		if err := c.BindJSON(&policy); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := validate.Struct(policy); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := models.ValidateTopic(policy.Topic); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if policy.MaxAge != "" {
+			if d, err := time.ParseDuration(policy.MaxAge); err != nil || d <= 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "max_age must be a positive duration such as 720h"})
+				return
+			}
+		}
+		if policy.MaxAge == "" && policy.MaxCount == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Set max_age, max_count or both"})
+			return
+		}
+
+		policy.UpdatedAt = time.Now()
+		policy.UpdatedBy = c.GetString("uid")
+		if _, err := retentionCollection.ReplaceOne(ctx, bson.M{"topic": policy.Topic}, policy, options.Replace().SetUpsert(true)); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"policy": policy})
+	}
+}
+
+// DeleteRetentionPolicy removes the policy for ?topic=, keeping that topic's messages until they expire
+func DeleteRetentionPolicy() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		topic, ok := c.GetQuery("topic")
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "topic is required"})
+			return
+		}
+		res, err := retentionCollection.DeleteOne(ctx, bson.M{"topic": topic})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if res.DeletedCount == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Retention policy not found"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Retention policy deleted"})
+	}
+}
+
+type topicUsage struct {
+	Topic    string                  `json:"topic" bson:"_id"`
+	Messages int64                   `json:"messages" bson:"messages"`
+	Bytes    int64                   `json:"bytes" bson:"bytes"`
+	Oldest   time.Time               `json:"oldest" bson:"oldest"`
+	Newest   time.Time               `json:"newest" bson:"newest"`
+	Policy   *models.RetentionPolicy `json:"policy,omitempty" bson:"-"`
+}
+
+// MessageStorage reports message count and size per topic, with the policy that applies to each
+func MessageStorage() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		cursor, err := messageCollection.Aggregate(ctx, mongo.Pipeline{
+			{{Key: "$group", Value: bson.M{
+				"_id":      bson.M{"$ifNull": bson.A{"$topic", ""}},
+				"messages": bson.M{"$sum": 1},
+				"bytes":    bson.M{"$sum": bson.M{"$bsonSize": "$$ROOT"}},
+				"oldest":   bson.M{"$min": bson.M{"$toDate": "$_id"}},
+				"newest":   bson.M{"$max": bson.M{"$toDate": "$_id"}},
+			}}},
+			{{Key: "$sort", Value: bson.M{"bytes": -1}}},
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		usage := []topicUsage{}
+		if err := cursor.All(ctx, &usage); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		policies, err := retentionPolicies(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		var totalMessages, totalBytes int64
+		for i := range usage {
+			if p, ok := policies[usage[i].Topic]; ok {
+				usage[i].Policy = &p
+			}
+			totalMessages += usage[i].Messages
+			totalBytes += usage[i].Bytes
+		}
+		c.JSON(http.StatusOK, gin.H{"topics": usage, "messages": totalMessages, "bytes": totalBytes})
+	}
+}
+
+func retentionPolicies(ctx context.Context) (map[string]models.RetentionPolicy, error) {
+	cursor, err := retentionCollection.Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	var list []models.RetentionPolicy
+	if err := cursor.All(ctx, &list); err != nil {
+		return nil, err
+	}
+	policies := make(map[string]models.RetentionPolicy, len(list))
+	for _, p := range list {
+		policies[p.Topic] = p
+	}
+	return policies, nil
+}
+
+// StartRetentionCompactor applies retention policies every config.RetentionInterval.
+// Expired messages are removed separately by the TTL index on expires_at.
+func StartRetentionCompactor(ctx context.Context) {
+	ticker := time.NewTicker(config.RetentionInterval)
+	defer ticker.Stop()
+	for {
+		compactMessages(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func compactMessages(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, config.RetentionInterval)
+	defer cancel()
+
+	policies, err := retentionPolicies(ctx)
+	if err != nil {
+		log.Println("Retention: failed to load policies:", err)
+		return
+	}
+	for _, p := range policies {
+		deleted, err := applyRetention(ctx, p)
+		if err != nil {
+			log.Printf("Retention: topic %q: %v", p.Topic, err)
+			continue
+		}
+		if deleted > 0 {
+			log.Printf("Retention: removed %d messages from topic %q", deleted, p.Topic)
+		}
+	}
+}
+
+// applyRetention deletes a topic's messages beyond its policy. Message ObjectIDs carry the time the
+// message was stored, so age and order come from _id rather than the publisher's timestamp.
+func applyRetention(ctx context.Context, p models.RetentionPolicy) (int64, error) {
+	topic := bson.M{"topic": p.Topic}
+	if p.Topic == "" {
+		topic = bson.M{"topic": bson.M{"$exists": false}}
+	}
+
+	var bounds bson.A
+	if p.MaxAge != "" {
+		maxAge, err := time.ParseDuration(p.MaxAge)
+		if err != nil {
+			return 0, err
+		}
+		bounds = append(bounds, bson.M{"_id": bson.M{"$lt": primitive.NewObjectIDFromTimestamp(time.Now().Add(-maxAge))}})
+	}
+	if p.MaxCount > 0 {
+		// The newest message beyond the limit; it and everything older go
+		var doc struct {
+			ID primitive.ObjectID `bson:"_id"`
+		}
+		err := messageCollection.FindOne(ctx, topic, options.FindOne().
+			SetSort(bson.D{{Key: "_id", Value: -1}}).
+			SetSkip(p.MaxCount).
+			SetProjection(bson.M{"_id": 1}),
+		).Decode(&doc)
+		if err == nil {
+			bounds = append(bounds, bson.M{"_id": bson.M{"$lte": doc.ID}})
+		} else if err != mongo.ErrNoDocuments {
+			return 0, err
+		}
+	}
+	if len(bounds) == 0 {
+		return 0, nil
+	}
+
+	filter := bson.M{"$or": bounds}
+	for k, v := range topic {
+		filter[k] = v
+	}
+	res, err := messageCollection.DeleteMany(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+	return res.DeletedCount, nil
+}
@@ -0,0 +1,170 @@
+package controllers
+
+import (
+	"context"
+	"encoding/binary"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	database "github.com/sachinggsingh/notify/internal/db"
+	"github.com/sachinggsingh/notify/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var scheduledCollection *mongo.Collection = database.OpenCollection(database.Client, "scheduled_message")
+
+const (
+	schedulerTick = time.Second
+	// A claim older than this belongs to a replica that died mid-publish
+	scheduleClaimTimeout = time.Minute
+)
+
+// scheduleMessage stores a message until its deliver_at
+func scheduleMessage(ctx context.Context, ownerID string, message models.Message) (models.ScheduledMessage, error) {
+	deliverAt := *message.DeliverAt
+	message.DeliverAt = nil
+
+	// The ObjectID carries the delivery time, so history order and retention treat the
+	// message as sent when it goes out rather than when it was scheduled
+	message.ID = primitive.NewObjectID()
+	binary.BigEndian.PutUint32(message.ID[0:4], uint32(deliverAt.Unix()))
+
+	scheduled := models.ScheduledMessage{
+		ID:        message.ID,
+		OwnerID:   ownerID,
+		Message:   message,
+		DeliverAt: deliverAt,
+		Status:    models.SchedulePending,
+		CreatedAt: time.Now(),
+	}
+	_, err := scheduledCollection.InsertOne(ctx, scheduled)
+	return scheduled, err
+}
+
+// StartScheduler publishes scheduled messages when they are due. Every replica runs it; a message
+// is claimed atomically before publishing, and it keeps the ID it was scheduled with, so a
+// publish retried after a crash cannot store it twice.
+func StartScheduler(ctx context.Context) {
+	ticker := time.NewTicker(schedulerTick)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		for publishNextScheduled(ctx) {
+		}
+	}
+}
+
+// publishNextScheduled claims and publishes one due message, reporting whether there was one
+func publishNextScheduled(ctx context.Context) bool {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	var scheduled models.ScheduledMessage
+	err := scheduledCollection.FindOneAndUpdate(ctx,
+		bson.M{"$or": bson.A{
+			bson.M{"status": models.SchedulePending, "deliver_at": bson.M{"$lte": now}},
+			bson.M{"status": models.SchedulePublishing, "claimed_at": bson.M{"$lt": now.Add(-scheduleClaimTimeout)}},
+		}},
+		bson.M{"$set": bson.M{"status": models.SchedulePublishing, "claimed_at": now}},
+		options.FindOneAndUpdate().SetSort(bson.D{{Key: "deliver_at", Value: 1}}).SetReturnDocument(options.After),
+	).Decode(&scheduled)
+	if err == mongo.ErrNoDocuments {
+		return false
+	}
+	if err != nil {
+		log.Println("Scheduler: failed to claim a message:", err)
+		return false
+	}
+
+	_, err = publishMessage(ctx, scheduled.Message)
+	if mongo.IsDuplicateKeyError(err) {
+		// An earlier claim stored the message but may have died before broadcasting it
+		err = rebroadcastStored(ctx, scheduled.ID)
+	}
+	if err != nil {
+		// Leave it claimed; it is picked up again once the claim times out
+		log.Println("Scheduler: failed to publish", scheduled.ID.Hex(), err)
+		return true
+	}
+	published := time.Now()
+	_, err = scheduledCollection.UpdateOne(ctx,
+		bson.M{"_id": scheduled.ID, "status": models.SchedulePublishing},
+		bson.M{"$set": bson.M{"status": models.SchedulePublished, "published_at": published}, "$unset": bson.M{"claimed_at": ""}},
+	)
+	if err != nil {
+		log.Println("Scheduler: failed to mark", scheduled.ID.Hex(), "published:", err)
+	}
+	return true
+}
+
+// ListScheduledMessages returns the caller's scheduled messages, soonest first. ?status= defaults to pending.
+func ListScheduledMessages() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		filter := bson.M{"owner_id": c.GetString("uid"), "status": c.DefaultQuery("status", models.SchedulePending)}
+		page, limit := pagination(c)
+		opts := options.Find().
+			SetSort(bson.D{{Key: "deliver_at", Value: 1}}).
+			SetSkip((page - 1) * limit).
+			SetLimit(limit)
+		cursor, err := scheduledCollection.Find(ctx, filter, opts)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		scheduled := []models.ScheduledMessage{}
+		if err := cursor.All(ctx, &scheduled); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"scheduled": scheduled, "page": page, "limit": limit})
+	}
+}
+
+// CancelScheduledMessage cancels one of the caller's messages that has not gone out yet
+func CancelScheduledMessage() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		id, err := primitive.ObjectIDFromHex(c.Param("message_id"))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Scheduled message not found"})
+			return
+		}
+		owner := bson.M{"_id": id, "owner_id": c.GetString("uid")}
+
+		var scheduled models.ScheduledMessage
+		err = scheduledCollection.FindOneAndUpdate(ctx,
+			bson.M{"_id": id, "owner_id": c.GetString("uid"), "status": models.SchedulePending},
+			bson.M{"$set": bson.M{"status": models.ScheduleCancelled}},
+			options.FindOneAndUpdate().SetReturnDocument(options.After),
+		).Decode(&scheduled)
+		if err == mongo.ErrNoDocuments {
+			count, _ := scheduledCollection.CountDocuments(ctx, owner)
+			if count == 0 {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Scheduled message not found"})
+			} else {
+				c.JSON(http.StatusConflict, gin.H{"error": "Message has already been sent or cancelled"})
+			}
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Scheduled message cancelled", "scheduled": scheduled})
+	}
+}
@@ -1,103 +1,301 @@
 package controllers
 
 import (
+	"bytes"
 	"context"
-	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
 	"net/http"
+	"regexp"
+	"strings"
 	"time"
 
-	"github.com/cloudinary/cloudinary-go/api/uploader"
 	"github.com/gin-gonic/gin"
 	config "github.com/sachinggsingh/notify/internal/config"
 	database "github.com/sachinggsingh/notify/internal/db"
+	helper "github.com/sachinggsingh/notify/internal/helpers"
 	"github.com/sachinggsingh/notify/internal/models"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 var uploadImageCollection *mongo.Collection = database.OpenCollection(database.Client, "image")
 
+// Client-chosen public ids become part of a storage key, so only plain names are allowed
+var publicIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,100}$`)
+
+func validatePublicID(publicID string) *helper.UploadError {
+	if publicID != "" && !publicIDPattern.MatchString(publicID) {
+		return &helper.UploadError{Status: http.StatusBadRequest, Code: "invalid_public_id", Message: "public_id may only contain letters, digits, '-' and '_'"}
+	}
+	return nil
+}
+
 func UploadFile() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+		ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
 		defer cancel()
 
+		// Leave room for the multipart envelope around the file itself
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, config.Upload.MaxBytes+1<<20)
+
 		file, err := c.FormFile("image")
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Image file is required"})
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				uploadErr := helper.FileTooLarge()
+				c.JSON(uploadErr.Status, uploadErr)
+				return
+			}
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Image file is required", "code": "missing_file"})
 			return
 		}
 
-		// Open the file
-		f, err := file.Open()
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to open image file"})
+		data, uploadErr := readUploadedFile(file)
+		if uploadErr != nil {
+			c.JSON(uploadErr.Status, uploadErr)
 			return
 		}
-		defer f.Close()
-
-		publicID := c.DefaultPostForm("public_id", "")
 
-		// Upload to Cloudinary
-		uploadResult, err := config.Cld.Upload.Upload(ctx, f, uploader.UploadParams{
-			PublicID: publicID,
-			Folder:   "notify",
+		imageDoc, uploadErr := storeUpload(ctx, uploadRequest{
+			OwnerID:  c.GetString("uid"),
+			UserID:   c.PostForm("user_id"), // if user_id is submitted in the form
+			PublicID: c.DefaultPostForm("public_id", ""),
+			Filename: file.Filename,
+			Topic:    c.PostForm("topic"),
+			Locale:   c.PostForm("locale"),
+			Data:     data,
 		})
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Cloudinary upload error: " + err.Error()})
+		if uploadErr != nil {
+			c.JSON(uploadErr.Status, uploadErr)
 			return
 		}
 
-		var image models.Image
-		image.ID = primitive.NewObjectID()
-		image.Image_id = image.ID.Hex()
+		c.JSON(http.StatusOK, gin.H{
+			"message": "File uploaded successfully",
+			"data":    uploadResponseData(imageDoc),
+		})
+	}
+}
+
+// uploadRequest is everything the upload pipeline needs, detached from the HTTP request
+type uploadRequest struct {
+	OwnerID  string
+	UserID   string // user_id put on the notification message
+	PublicID string
+	Filename string
+	Topic    string
+	Locale   string // language for the caption
+	Data     []byte
+}
 
-		imageDoc := models.Image{
-			ID:       image.ID,
-			Uploaded: time.Now(),
-			URL:      uploadResult.SecureURL,
-			PublicID: uploadResult.PublicID,
-			Image_id: image.Image_id,
-		}
+// storeUpload validates the image, stores it with its variants, records it in Mongo
+// and queues caption generation. Single, batch and resumable uploads all end here.
+func storeUpload(ctx context.Context, req uploadRequest) (models.Image, *helper.UploadError) {
+	if err := models.ValidateTopic(req.Topic); err != nil {
+		return models.Image{}, &helper.UploadError{Status: http.StatusBadRequest, Code: "invalid_topic", Message: err.Error()}
+	}
+	if uploadErr := validatePublicID(req.PublicID); uploadErr != nil {
+		return models.Image{}, uploadErr
+	}
+	info, uploadErr := helper.ValidateImage(req.Data)
+	if uploadErr != nil {
+		return models.Image{}, uploadErr
+	}
+
+	var image models.Image
+	image.ID = primitive.NewObjectID()
+	image.Image_id = image.ID.Hex()
+
+	publicID := req.PublicID
+	if publicID == "" {
+		publicID = image.Image_id
+	}
+	// Keys are namespaced by owner so nobody can overwrite another user's object by reusing its id
+	prefix := "images/" + req.OwnerID + "/" + publicID
+	key := prefix + info.Extension
+
+	// Upload to the configured storage backend
+	stored, err := config.Store.Put(ctx, key, bytes.NewReader(req.Data), info.ContentType)
+	if err != nil {
+		return models.Image{}, &helper.UploadError{Status: http.StatusInternalServerError, Code: "storage_error", Message: "Storage upload error: " + err.Error()}
+	}
+
+	imageDoc := models.Image{
+		ID:       image.ID,
+		Uploaded: time.Now(),
+		URL:      stored.URL,
+		PublicID: stored.Key,
+		Image_id: image.Image_id,
+		OwnerID:  req.OwnerID,
+		Variants: generateVariants(ctx, prefix, info),
+		Filename: req.Filename,
+		Topic:    req.Topic,
+
+		CaptionStatus: models.CaptionPending,
+		CaptionLocale: req.Locale,
+	}
+
+	if _, err := uploadImageCollection.InsertOne(ctx, imageDoc); err != nil {
+		return models.Image{}, &helper.UploadError{Status: http.StatusInternalServerError, Code: "database_error", Message: "Failed to save upload details"}
+	}
+
+	enqueueCaption(ctx, &imageDoc, req.UserID)
+
+	return imageDoc, nil
+}
+
+func uploadResponseData(image models.Image) gin.H {
+	return gin.H{
+		"id":        image.ID,
+		"url":       image.URL,
+		"public_id": image.PublicID,
+		"image_id":  image.Image_id,
+		"variants":  image.Variants,
+
+		"caption_status": image.CaptionStatus,
+	}
+}
 
-		result, err := uploadImageCollection.InsertOne(ctx, imageDoc)
+// UploadFiles accepts several images in one multipart request under the "images" field.
+// Each file is processed independently; the response reports a result per file.
+func UploadFiles() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+		defer cancel()
+
+		maxFiles := int64(config.Upload.MaxFiles)
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, config.Upload.MaxBytes*maxFiles+1<<20)
+
+		form, err := c.MultipartForm()
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save upload details"})
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				uploadErr := helper.FileTooLarge()
+				c.JSON(uploadErr.Status, uploadErr)
+				return
+			}
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid multipart form", "code": "invalid_form"})
 			return
 		}
 
-		go func() {
-			genCtx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
-			defer cancel()
-			caption, err := config.GenerateCaption(genCtx, imageDoc.URL)
+		files := form.File["images"]
+		if len(files) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "At least one file is required in the images field", "code": "missing_file"})
+			return
+		}
+		if len(files) > config.Upload.MaxFiles {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("At most %d files can be uploaded at once", config.Upload.MaxFiles), "code": "too_many_files"})
+			return
+		}
 
-			if err != nil {
-				caption = "A new file has been uploaded"
+		results := make([]gin.H, 0, len(files))
+		failed := 0
+		for _, file := range files {
+			data, uploadErr := readUploadedFile(file)
+			var imageDoc models.Image
+			if uploadErr == nil {
+				imageDoc, uploadErr = storeUpload(ctx, uploadRequest{
+					OwnerID:  c.GetString("uid"),
+					UserID:   c.PostForm("user_id"),
+					Filename: file.Filename,
+					Topic:    c.PostForm("topic"),
+					Locale:   c.PostForm("locale"),
+					Data:     data,
+				})
 			}
-			msg := models.Message{
-				UserID:    c.PostForm("user_id"), // if user_id is submitted in the form
-				Content:   caption,
-				Timestamp: time.Now(),
+			if uploadErr != nil {
+				failed++
+				results = append(results, gin.H{"filename": file.Filename, "status": uploadErr.Status, "code": uploadErr.Code, "error": uploadErr.Message})
+				continue
 			}
-			// store message in DB and publish to Redis so subscribers receive it
-			_, _ = messageCollection.InsertOne(genCtx, msg) // messageCollection is in package controllers (pub_sub_controller.go)
-			data, _ := json.Marshal(msg)
-			_ = config.RDB.Publish(genCtx, "message", data).Err()
-		}()
+			results = append(results, gin.H{"filename": file.Filename, "status": http.StatusOK, "data": uploadResponseData(imageDoc)})
+		}
 
-		c.JSON(http.StatusOK, gin.H{
-			"message": "File uploaded successfully",
-			"data": gin.H{
-				"id":        result.InsertedID,
-				"url":       imageDoc.URL,
-				"public_id": imageDoc.PublicID,
-				"image_id":  imageDoc.Image_id,
-			},
+		status := http.StatusOK
+		if failed > 0 {
+			status = http.StatusMultiStatus
+		}
+		c.JSON(status, gin.H{
+			"message":   fmt.Sprintf("%d of %d files uploaded", len(files)-failed, len(files)),
+			"results":   results,
+			"uploaded":  len(files) - failed,
+			"failed":    failed,
+			"requested": len(files),
 		})
 	}
 }
 
+// generateVariants renders and stores every configured variant next to the original.
+// A variant that fails is logged and skipped rather than failing the upload.
+func generateVariants(ctx context.Context, baseKey string, info helper.ImageInfo) map[string]models.ImageVariant {
+	variants := make(map[string]models.ImageVariant, len(config.Upload.Variants))
+	for _, spec := range config.Upload.Variants {
+		img := helper.ResizeImage(info.Image, spec.MaxEdge)
+
+		format := spec.Format
+		if format == "" {
+			format = info.Format
+		}
+		var buf bytes.Buffer
+		contentType, ext, err := helper.EncodeImage(&buf, img, format)
+		if err != nil {
+			log.Printf("Failed to encode %s variant: %v", spec.Name, err)
+			continue
+		}
+
+		size := int64(buf.Len())
+		stored, err := config.Store.Put(ctx, baseKey+"_"+spec.Name+ext, &buf, contentType)
+		if err != nil {
+			log.Printf("Failed to store %s variant: %v", spec.Name, err)
+			continue
+		}
+		variants[spec.Name] = models.ImageVariant{
+			Key:         stored.Key,
+			URL:         stored.URL,
+			Width:       img.Bounds().Dx(),
+			Height:      img.Bounds().Dy(),
+			ContentType: contentType,
+			Size:        size,
+		}
+	}
+	return variants
+}
+
+func variantURLs(variants map[string]models.ImageVariant) map[string]string {
+	urls := make(map[string]string, len(variants))
+	for name, v := range variants {
+		urls[name] = v.URL
+	}
+	return urls
+}
+
+// readUploadedFile reads at most one byte past the limit so oversized files are detected without buffering them whole
+func readUploadedFile(file *multipart.FileHeader) ([]byte, *helper.UploadError) {
+	if file.Size > config.Upload.MaxBytes {
+		return nil, helper.FileTooLarge()
+	}
+	f, err := file.Open()
+	if err != nil {
+		return nil, &helper.UploadError{Status: http.StatusBadRequest, Code: "unreadable_file", Message: "Failed to open image file"}
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(io.LimitReader(f, config.Upload.MaxBytes+1))
+	if err != nil {
+		return nil, &helper.UploadError{Status: http.StatusBadRequest, Code: "unreadable_file", Message: "Failed to read image file"}
+	}
+	if int64(len(data)) > config.Upload.MaxBytes {
+		return nil, helper.FileTooLarge()
+	}
+	return data, nil
+}
+
 // GetImage retrieves an image record by public_id (image_id) from MongoDB
 func GetImage() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -110,18 +308,178 @@ func GetImage() gin.HandlerFunc {
 			return
 		}
 
-		var image models.Image
-		err := uploadImageCollection.FindOne(ctx, bson.M{"image_id": imageID}).Decode(&image)
-		if err != nil {
-			if err == mongo.ErrNoDocuments {
-				c.JSON(http.StatusNotFound, gin.H{"error": "Image not found"})
-				return
+		image, ok := findAccessibleImage(ctx, c, imageID)
+		if !ok {
+			return
+		}
+
+		refreshImageURLs(ctx, &image)
+		c.JSON(http.StatusOK, gin.H{"image": image})
+	}
+}
+
+// ListImages pages through the caller's images, newest first. Admins may pass
+// ?owner_id= to list another user's images, or ?all=true for every image.
+// ?tag= (repeatable, all must match) filters by AI tags and ?q= searches alt text, caption and objects.
+func ListImages() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		filter := bson.M{"owner_id": c.GetString("uid")}
+		if c.GetString("role") == models.RoleAdmin {
+			if ownerID := c.Query("owner_id"); ownerID != "" {
+				filter["owner_id"] = ownerID
+			} else if c.Query("all") == "true" {
+				delete(filter, "owner_id")
+			}
+		}
+
+		if tags := c.QueryArray("tag"); len(tags) > 0 {
+			for i := range tags {
+				tags[i] = strings.ToLower(strings.TrimSpace(tags[i]))
 			}
+			filter["tags"] = bson.M{"$all": tags}
+		}
+		if q := strings.TrimSpace(c.Query("q")); q != "" {
+			filter["$text"] = bson.M{"$search": q}
+		}
+
+		page, limit := pagination(c)
+		total, err := uploadImageCollection.CountDocuments(ctx, filter)
+		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{"image": image})
+		opts := options.Find().
+			SetSort(bson.D{{Key: "uploaded", Value: -1}}).
+			SetSkip((page - 1) * limit).
+			SetLimit(limit)
+		cursor, err := uploadImageCollection.Find(ctx, filter, opts)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		images := []models.Image{}
+		if err := cursor.All(ctx, &images); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		for i := range images {
+			refreshImageURLs(ctx, &images[i])
+		}
+
+		c.JSON(http.StatusOK, gin.H{"images": images, "total": total, "page": page, "limit": limit})
+	}
+}
+
+// DeleteImage removes the image from storage and Mongo and announces it with an image.deleted event
+func DeleteImage() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		image, ok := findAccessibleImage(ctx, c, c.Param("image_id"))
+		if !ok {
+			return
+		}
+
+		deleteImageFiles(ctx, image)
+		if _, err := uploadImageCollection.DeleteOne(ctx, bson.M{"image_id": image.Image_id}); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete image"})
+			return
+		}
+
+		err := publishEvent(ctx, "image.deleted", c.GetString("uid"), map[string]any{
+			"image_id": image.Image_id,
+			"owner_id": image.OwnerID,
+		})
+		if err != nil {
+			log.Println("Failed to publish image.deleted event:", err)
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Image deleted", "image_id": image.Image_id})
+	}
+}
+
+// findAccessibleImage loads an image the caller owns (or any image for admins) and writes
+// the error response itself. Other users' images are reported as not found.
+func findAccessibleImage(ctx context.Context, c *gin.Context, imageID string) (models.Image, bool) {
+	var image models.Image
+	err := uploadImageCollection.FindOne(ctx, bson.M{"image_id": imageID}).Decode(&image)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Image not found"})
+		return image, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return image, false
+	}
+	if image.OwnerID != c.GetString("uid") && c.GetString("role") != models.RoleAdmin {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Image not found"})
+		return image, false
+	}
+	return image, true
+}
+
+// refreshImageURLs replaces stored URLs, which may be signed and expired, with fresh ones
+func refreshImageURLs(ctx context.Context, image *models.Image) {
+	if url, err := config.Store.URL(ctx, image.PublicID); err == nil {
+		image.URL = url
+	}
+	for name, v := range image.Variants {
+		if url, err := config.Store.URL(ctx, v.Key); err == nil {
+			v.URL = url
+			image.Variants[name] = v
+		}
+	}
+}
+
+func deleteImageFiles(ctx context.Context, image models.Image) {
+	if err := config.Store.Delete(ctx, image.PublicID); err != nil && err != config.ErrObjectNotFound {
+		log.Println("Failed to delete image from storage:", image.PublicID, err)
+	}
+	for _, v := range image.Variants {
+		if err := config.Store.Delete(ctx, v.Key); err != nil && err != config.ErrObjectNotFound {
+			log.Println("Failed to delete image variant from storage:", v.Key, err)
+		}
+	}
+}
+
+// ServeFile serves objects from the local storage driver behind signed, expiring URLs
+func ServeFile() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		local, ok := config.Store.(*config.LocalStorage)
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "File serving is only available with the local storage driver"})
+			return
+		}
+
+		key := strings.TrimPrefix(c.Param("key"), "/")
+		if !local.VerifySignature(key, c.Query("expires"), c.Query("signature")) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Invalid or expired file signature"})
+			return
+		}
+
+		f, err := local.Open(key)
+		if err == config.ErrObjectNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		defer f.Close()
+
+		info, err := f.Stat()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.Header("Cache-Control", "private, max-age=3600")
+		http.ServeContent(c.Writer, c.Request, info.Name(), info.ModTime(), f)
 	}
 }
 
@@ -2,11 +2,14 @@ package controllers
 
 import (
 	"context"
+	"log"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
+	config "github.com/sachinggsingh/notify/internal/config"
 	database "github.com/sachinggsingh/notify/internal/db"
 	helper "github.com/sachinggsingh/notify/internal/helpers"
 	"github.com/sachinggsingh/notify/internal/models"
@@ -61,8 +64,13 @@ func CreateUser() gin.HandlerFunc {
 		user.UpdatedAt, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
 		user.ID = primitive.NewObjectID()
 		user.User_id = user.ID.Hex()
+		user.Verified = false
+		user.FailedLogins = 0
+		user.LockedUntil = nil
+		user.Disabled = false
+		user.Role = models.RoleUser
 
-		tokenResponse := helper.GenerateToken(*user.Email, user.User_id)
+		tokenResponse := helper.GenerateToken(*user.Email, user.User_id, user.Role, 0)
 		if tokenResponse.Err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": tokenResponse.Err.Error()})
 			return
@@ -77,6 +85,10 @@ func CreateUser() gin.HandlerFunc {
 			return
 		}
 
+		if err := sendVerificationEmail(ctx, user); err != nil {
+			log.Println("Failed to send verification email:", err)
+		}
+
 		c.JSON(http.StatusOK, gin.H{"message": "User created successfully", "data": result})
 	}
 }
@@ -102,13 +114,52 @@ func Login() gin.HandlerFunc {
 			return
 		}
 
+		if foundUser.Disabled {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Account is disabled"})
+			return
+		}
+
+		if foundUser.LockedUntil != nil && foundUser.LockedUntil.After(time.Now()) {
+			c.Header("Retry-After", strconv.Itoa(int(time.Until(*foundUser.LockedUntil).Seconds())+1))
+			c.JSON(http.StatusLocked, gin.H{"error": "account is temporarily locked after too many failed login attempts"})
+			return
+		}
+
+		if foundUser.Password == nil || loggedDetails.Password == nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "login or password is incorrect"})
+			return
+		}
+
 		passwordIsValid, msg := helper.VerifyPassword(*foundUser.Password, *loggedDetails.Password)
 		if !passwordIsValid {
+			if err := recordFailedLogin(ctx, foundUser.User_id); err != nil {
+				log.Println("Failed to record failed login:", err)
+			}
 			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
 			return
 		}
 
-		tokenResponse := helper.GenerateToken(*foundUser.Email, foundUser.User_id)
+		if config.Account.RequireVerifiedEmail && !foundUser.Verified {
+			c.JSON(http.StatusForbidden, gin.H{"error": "email address has not been verified"})
+			return
+		}
+
+		if foundUser.FailedLogins > 0 || foundUser.LockedUntil != nil {
+			_, err := userCollection.UpdateOne(ctx, bson.M{"user_id": foundUser.User_id}, bson.M{
+				"$set":   bson.M{"failed_logins": 0},
+				"$unset": bson.M{"locked_until": ""},
+			})
+			if err != nil {
+				log.Println("Failed to reset failed login counter:", err)
+			}
+		}
+
+		session, err := config.SessionGeneration(ctx, foundUser.User_id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, bson.M{"error": "Internal server error"})
+			return
+		}
+		tokenResponse := helper.GenerateToken(*foundUser.Email, foundUser.User_id, config.RoleFor(foundUser), session)
 		if tokenResponse.Err != nil {
 			c.JSON(http.StatusInternalServerError, bson.M{"error": "Internal server error"})
 			return
@@ -121,3 +172,19 @@ func Login() gin.HandlerFunc {
 		c.JSON(http.StatusOK, tokenResponse)
 	}
 }
+
+// recordFailedLogin counts a failed attempt and locks the account once the limit is reached.
+// Counting and locking happen in one update, so concurrent failures cannot skip the lock.
+func recordFailedLogin(ctx context.Context, userID string) error {
+	reached := bson.M{"$gte": bson.A{"$failed_logins", config.Account.MaxFailedLogins}}
+	_, err := userCollection.UpdateOne(ctx, bson.M{"user_id": userID}, mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{
+			"failed_logins": bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$failed_logins", 0}}, 1}},
+		}}},
+		{{Key: "$set", Value: bson.M{
+			"locked_until":  bson.M{"$cond": bson.A{reached, time.Now().Add(config.Account.LockoutDuration), "$locked_until"}},
+			"failed_logins": bson.M{"$cond": bson.A{reached, 0, "$failed_logins"}},
+		}}},
+	})
+	return err
+}
@@ -0,0 +1,195 @@
+// Package filter compiles subscription filter expressions and evaluates them against
+// messages decoded from JSON. An expression looks like
+//
+//	metadata.severity in ["high", "critical"] && user_id != me
+//
+// Operands are field paths into the message (user_id, topic, metadata.tags, ...), string,
+// number, boolean and null literals, arrays of literals, and me (the subscriber's user id).
+// Operators are ==, !=, <, <=, >, >=, in, &&, || and !, with parentheses for grouping.
+// A path on its own is true when the field is present and truthy.
+package filter
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	MaxLength = 1024
+	maxDepth  = 32
+)
+
+// Filter is a compiled expression; it is safe for concurrent use
+type Filter struct {
+	source string
+	root   node
+}
+
+func (f *Filter) String() string {
+	return f.source
+}
+
+// Compile parses expr once so it can be evaluated cheaply for every message
+func Compile(expr string) (*Filter, error) {
+	if len(expr) > MaxLength {
+		return nil, fmt.Errorf("filter is longer than %d characters", MaxLength)
+	}
+	toks, err := lex(expr)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{toks: toks}
+	root, err := p.parseOr(0)
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, fmt.Errorf("unexpected %s at position %d", t, t.pos)
+	}
+	return &Filter{source: strings.TrimSpace(expr), root: root}, nil
+}
+
+// Match reports whether doc, a message decoded into a map, passes the filter for subscriber me
+func (f *Filter) Match(doc map[string]any, me string) bool {
+	return truthy(f.root.eval(env{doc: doc, me: me}))
+}
+
+type env struct {
+	doc map[string]any
+	me  string
+}
+
+type node interface {
+	eval(e env) any
+}
+
+type literal struct{ value any }
+
+func (n literal) eval(env) any { return n.value }
+
+type meNode struct{}
+
+func (meNode) eval(e env) any { return e.me }
+
+type path []string
+
+func (n path) eval(e env) any {
+	var cur any = e.doc
+	for _, key := range n {
+		m, ok := cur.(map[string]any)
+		if !ok {
+			return nil
+		}
+		cur = m[key]
+	}
+	return cur
+}
+
+type not struct{ x node }
+
+func (n not) eval(e env) any { return !truthy(n.x.eval(e)) }
+
+type logical struct {
+	op   string
+	l, r node
+}
+
+func (n logical) eval(e env) any {
+	if n.op == "&&" {
+		return truthy(n.l.eval(e)) && truthy(n.r.eval(e))
+	}
+	return truthy(n.l.eval(e)) || truthy(n.r.eval(e))
+}
+
+type compare struct {
+	op   string
+	l, r node
+}
+
+func (n compare) eval(e env) any {
+	l, r := n.l.eval(e), n.r.eval(e)
+	switch n.op {
+	case "==":
+		return equal(l, r)
+	case "!=":
+		return !equal(l, r)
+	case "in":
+		return contains(l, r)
+	}
+	lf, lok := l.(float64)
+	rf, rok := r.(float64)
+	if !lok || !rok {
+		ls, lok := l.(string)
+		rs, rok := r.(string)
+		if !lok || !rok {
+			return false
+		}
+		lf, rf = float64(strings.Compare(ls, rs)), 0
+	}
+	switch n.op {
+	case "<":
+		return lf < rf
+	case "<=":
+		return lf <= rf
+	case ">":
+		return lf > rf
+	default:
+		return lf >= rf
+	}
+}
+
+func equal(a, b any) bool {
+	switch av := a.(type) {
+	case nil:
+		return b == nil
+	case string:
+		bv, ok := b.(string)
+		return ok && av == bv
+	case float64:
+		bv, ok := b.(float64)
+		return ok && av == bv
+	case bool:
+		bv, ok := b.(bool)
+		return ok && av == bv
+	}
+	return false
+}
+
+// contains implements "x in list". When x is itself a list (e.g. metadata.tags) it matches if
+// any element is in list, so tags in ["a", "b"] means "tagged a or b".
+func contains(x, list any) bool {
+	items, ok := list.([]any)
+	if !ok {
+		return false
+	}
+	if xs, ok := x.([]any); ok {
+		for _, v := range xs {
+			if contains(v, items) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, item := range items {
+		if equal(x, item) {
+			return true
+		}
+	}
+	return false
+}
+
+func truthy(v any) bool {
+	switch v := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case string:
+		return v != ""
+	case float64:
+		return v != 0
+	case []any:
+		return len(v) > 0
+	}
+	return true
+}
@@ -0,0 +1,148 @@
+package filter
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+const testMessage = `{
+	"type": "upload",
+	"topic": "uploads/team-a",
+	"user_id": "u1",
+	"content": "cat on a mat",
+	"priority": 5,
+	"metadata": {
+		"severity": "high",
+		"tags": ["cat", "outdoor"],
+		"score": 0.75,
+		"public": true,
+		"empty": "",
+		"nothing": null,
+		"nested": {"level": 2}
+	}
+}`
+
+func TestMatch(t *testing.T) {
+	var doc map[string]any
+	if err := json.Unmarshal([]byte(testMessage), &doc); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		// Equality and literals
+		{`type == "upload"`, true},
+		{`type == 'upload'`, true},
+		{`type != "upload"`, false},
+		{`priority == 5`, true},
+		{`priority == "5"`, false},
+		{`metadata.public == true`, true},
+		{`metadata.nothing == null`, true},
+		{`metadata.missing == null`, true},
+		{`metadata.nested.level == 2`, true},
+		{`metadata.tags == "cat"`, false},
+
+		// Ordering on numbers and strings; mixed types never compare
+		{`priority > 4`, true},
+		{`priority >= 5`, true},
+		{`priority < 5`, false},
+		{`metadata.score <= 0.75`, true},
+		{`metadata.score > -1`, true},
+		{`metadata.severity > "a"`, true},
+		{`metadata.severity < "a"`, false},
+		{`metadata.severity > 1`, false},
+		{`metadata.missing < 1`, false},
+
+		// in, including list fields matching any element
+		{`metadata.severity in ["high", "critical"]`, true},
+		{`metadata.severity in ["low"]`, false},
+		{`metadata.severity in []`, false},
+		{`metadata.tags in ["dog", "cat"]`, true},
+		{`metadata.tags in ["dog"]`, false},
+		{`priority in [1, 5, 9]`, true},
+		{`type in "upload"`, false},
+
+		// me is the subscriber
+		{`user_id == me`, true},
+		{`user_id != me`, false},
+
+		// Truthiness of bare paths
+		{`metadata.public`, true},
+		{`metadata.empty`, false},
+		{`metadata.nothing`, false},
+		{`metadata.missing`, false},
+		{`metadata.tags`, true},
+		{`metadata.nested`, true},
+		{`!metadata.missing`, true},
+
+		// Logic and precedence: && binds tighter than ||
+		{`type == "upload" && priority > 3`, true},
+		{`type == "upload" && priority > 7`, false},
+		{`type == "chat" || priority > 3`, true},
+		{`type == "chat" || priority > 7 && metadata.public`, false},
+		{`type == "upload" || priority > 7 && false`, true},
+		{`(type == "upload" || priority > 7) && false`, false},
+		{`!(type == "chat")`, true},
+		{`!!metadata.public`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			f, err := Compile(tt.expr)
+			if err != nil {
+				t.Fatalf("Compile: %v", err)
+			}
+			if got := f.Match(doc, "u1"); got != tt.want {
+				t.Errorf("Match = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := []struct {
+		expr    string
+		wantErr string
+	}{
+		{``, "unexpected end of filter"},
+		{`type ==`, "unexpected end of filter"},
+		{`type == "upload`, "unterminated string"},
+		{`type = "upload"`, "unexpected character"},
+		{`type == "a" &&`, "unexpected end of filter"},
+		{`(type == "a"`, `expected ")"`},
+		{`type == "a")`, `unexpected ")"`},
+		{`type "a"`, `unexpected "a"`},
+		{`type in [user_id]`, "lists may only contain literals"},
+		{`type in [[1]]`, "lists cannot be nested"},
+		{`type in [1, 2`, `expected ","`},
+		{`in == 1`, `unexpected "in"`},
+		{`metadata..x`, "invalid field path"},
+		{`priority == 1.2.3`, "invalid number"},
+		{`type @ 1`, "unexpected character"},
+		{strings.Repeat("(", 40) + "true" + strings.Repeat(")", 40), "nested too deeply"},
+		{strings.Repeat("!", 40) + "true", "nested too deeply"},
+		{strings.Repeat("a", MaxLength+1), "longer than"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, err := Compile(tt.expr)
+			if err == nil {
+				t.Fatal("Compile succeeded")
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error %q does not mention %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestString(t *testing.T) {
+	f, err := Compile("  user_id == me  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.String() != "user_id == me" {
+		t.Errorf("String() = %q", f.String())
+	}
+}
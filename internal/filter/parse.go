@@ -0,0 +1,272 @@
+package filter
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type tokKind int
+
+const (
+	tokEOF tokKind = iota
+	tokIdent
+	tokString
+	tokNumber
+	tokOp
+)
+
+type token struct {
+	kind tokKind
+	text string
+	pos  int
+}
+
+func (t token) String() string {
+	if t.kind == tokEOF {
+		return "end of filter"
+	}
+	return strconv.Quote(t.text)
+}
+
+// Two-character operators must come before their one-character prefixes
+var operators = []string{"&&", "||", "==", "!=", "<=", ">=", "<", ">", "!", "(", ")", "[", "]", ","}
+
+func lex(src string) ([]token, error) {
+	var toks []token
+	for i := 0; i < len(src); {
+		c := rune(src[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '"' || c == '\'':
+			end := i + 1
+			for end < len(src) && rune(src[end]) != c {
+				if src[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(src) {
+				return nil, fmt.Errorf("unterminated string at position %d", i)
+			}
+			raw := src[i : end+1]
+			if c == '\'' {
+				raw = `"` + strings.ReplaceAll(raw[1:len(raw)-1], `"`, `\"`) + `"`
+			}
+			s, err := strconv.Unquote(raw)
+			if err != nil {
+				return nil, fmt.Errorf("invalid string at position %d", i)
+			}
+			toks = append(toks, token{tokString, s, i})
+			i = end + 1
+		case c == '-' || (c >= '0' && c <= '9'):
+			end := i + 1
+			for end < len(src) && strings.ContainsRune("0123456789.eE+-", rune(src[end])) {
+				end++
+			}
+			toks = append(toks, token{tokNumber, src[i:end], i})
+			i = end
+		case c == '_' || unicode.IsLetter(c):
+			end := i + 1
+			for end < len(src) && (src[end] == '_' || src[end] == '.' || src[end] == '-' ||
+				unicode.IsLetter(rune(src[end])) || unicode.IsDigit(rune(src[end]))) {
+				end++
+			}
+			toks = append(toks, token{tokIdent, src[i:end], i})
+			i = end
+		default:
+			matched := false
+			for _, op := range operators {
+				if strings.HasPrefix(src[i:], op) {
+					toks = append(toks, token{tokOp, op, i})
+					i += len(op)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, fmt.Errorf("unexpected character %q at position %d", c, i)
+			}
+		}
+	}
+	return append(toks, token{kind: tokEOF, pos: len(src)}), nil
+}
+
+var compareOps = map[string]bool{"==": true, "!=": true, "<": true, "<=": true, ">": true, ">=": true}
+
+type parser struct {
+	toks []token
+	pos  int
+}
+
+func (p *parser) peek() token {
+	return p.toks[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.toks[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) isOp(text string) bool {
+	t := p.peek()
+	return t.kind == tokOp && t.text == text
+}
+
+func (p *parser) expect(text string) error {
+	if !p.isOp(text) {
+		t := p.peek()
+		return fmt.Errorf("expected %q but found %s at position %d", text, t, t.pos)
+	}
+	p.next()
+	return nil
+}
+
+func (p *parser) parseOr(depth int) (node, error) {
+	if depth > maxDepth {
+		return nil, fmt.Errorf("filter is nested too deeply")
+	}
+	l, err := p.parseAnd(depth)
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("||") {
+		p.next()
+		r, err := p.parseAnd(depth)
+		if err != nil {
+			return nil, err
+		}
+		l = logical{"||", l, r}
+	}
+	return l, nil
+}
+
+func (p *parser) parseAnd(depth int) (node, error) {
+	l, err := p.parseUnary(depth)
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("&&") {
+		p.next()
+		r, err := p.parseUnary(depth)
+		if err != nil {
+			return nil, err
+		}
+		l = logical{"&&", l, r}
+	}
+	return l, nil
+}
+
+func (p *parser) parseUnary(depth int) (node, error) {
+	if p.isOp("!") {
+		p.next()
+		if depth > maxDepth {
+			return nil, fmt.Errorf("filter is nested too deeply")
+		}
+		x, err := p.parseUnary(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		return not{x}, nil
+	}
+	return p.parseCompare(depth)
+}
+
+func (p *parser) parseCompare(depth int) (node, error) {
+	l, err := p.parsePrimary(depth)
+	if err != nil {
+		return nil, err
+	}
+	t := p.peek()
+	if !(t.kind == tokOp && compareOps[t.text]) && !(t.kind == tokIdent && t.text == "in") {
+		return l, nil
+	}
+	p.next()
+	r, err := p.parsePrimary(depth)
+	if err != nil {
+		return nil, err
+	}
+	return compare{t.text, l, r}, nil
+}
+
+func (p *parser) parsePrimary(depth int) (node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokString:
+		return literal{t.text}, nil
+	case tokNumber:
+		f, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %s at position %d", t, t.pos)
+		}
+		return literal{f}, nil
+	case tokIdent:
+		switch t.text {
+		case "true":
+			return literal{true}, nil
+		case "false":
+			return literal{false}, nil
+		case "null":
+			return literal{nil}, nil
+		case "me":
+			return meNode{}, nil
+		case "in":
+			return nil, fmt.Errorf("unexpected %s at position %d", t, t.pos)
+		}
+		parts := strings.Split(t.text, ".")
+		for _, part := range parts {
+			if part == "" {
+				return nil, fmt.Errorf("invalid field path %s at position %d", t, t.pos)
+			}
+		}
+		return path(parts), nil
+	case tokOp:
+		switch t.text {
+		case "(":
+			x, err := p.parseOr(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			return x, p.expect(")")
+		case "[":
+			return p.parseList()
+		}
+	}
+	return nil, fmt.Errorf("unexpected %s at position %d", t, t.pos)
+}
+
+// parseList reads a list of literals after the opening bracket
+func (p *parser) parseList() (node, error) {
+	items := []any{}
+	if p.isOp("]") {
+		p.next()
+		return literal{items}, nil
+	}
+	for {
+		t := p.peek()
+		item, err := p.parsePrimary(maxDepth)
+		if err != nil {
+			return nil, err
+		}
+		lit, ok := item.(literal)
+		if !ok {
+			return nil, fmt.Errorf("lists may only contain literals (position %d)", t.pos)
+		}
+		if _, nested := lit.value.([]any); nested {
+			return nil, fmt.Errorf("lists cannot be nested (position %d)", t.pos)
+		}
+		items = append(items, lit.value)
+		if p.isOp("]") {
+			p.next()
+			return literal{items}, nil
+		}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+	}
+}
@@ -2,6 +2,8 @@ package helpers
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/base64"
 	"errors"
 	"log"
 	"os"
@@ -20,18 +22,25 @@ import (
 var userCollection *mongo.Collection = database.OpenCollection(database.Client, "user")
 var SECRET_KEY = os.Getenv("SECRET")
 
-func GenerateToken(email string, user_id string) models.TokenResponse {
+// TokenLifetime is how long issued access and refresh tokens stay valid
+const TokenLifetime = 24 * time.Hour
+
+// GenerateToken issues an access and a refresh token. session is the user's current session
+// generation, so the tokens stop working when the user's sessions are ended.
+func GenerateToken(email string, user_id string, role string, session int64) models.TokenResponse {
 	claims := &models.SignedDetails{
-		Email:  email,
-		UserID: user_id,
+		Email:   email,
+		UserID:  user_id,
+		Role:    role,
+		Session: session,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(TokenLifetime)),
 		},
 	}
 
 	refreshClaims := &models.SignedDetails{
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(TokenLifetime)),
 		},
 	}
 
@@ -94,6 +103,13 @@ func UpdateToken(signedToken string, signedRefreshtoken string, user_id string)
 	}
 }
 
+// FindUser loads the user as currently stored
+func FindUser(ctx context.Context, userID string) (models.User, error) {
+	var user models.User
+	err := userCollection.FindOne(ctx, bson.M{"user_id": userID}).Decode(&user)
+	return user, err
+}
+
 func ValidateToken(signedToken string) (*models.SignedDetails, error) {
 	token, err := jwt.ParseWithClaims(signedToken, &models.SignedDetails{}, func(token *jwt.Token) (any, error) {
 		return []byte(SECRET_KEY), nil
@@ -132,3 +148,12 @@ func HashPassword(password string) (string, error) {
 	}
 	return string(bytes), nil
 }
+
+// RandomString returns a URL-safe random string built from n random bytes
+func RandomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
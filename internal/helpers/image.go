@@ -0,0 +1,171 @@
+package helpers
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+
+	"github.com/HugoSmits86/nativewebp"
+	"github.com/sachinggsingh/notify/internal/config"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// UploadError is a client error raised while validating an upload
+type UploadError struct {
+	Status  int    `json:"-"`
+	Code    string `json:"code"`
+	Message string `json:"error"`
+}
+
+func (e *UploadError) Error() string {
+	return e.Message
+}
+
+type ImageInfo struct {
+	ContentType string
+	Format      string
+	Extension   string
+	Width       int
+	Height      int
+	Size        int64
+	Image       image.Image
+}
+
+var imageFormats = map[string]struct {
+	contentType string
+	extension   string
+}{
+	"jpeg": {"image/jpeg", ".jpg"},
+	"png":  {"image/png", ".png"},
+	"gif":  {"image/gif", ".gif"},
+	"webp": {"image/webp", ".webp"},
+}
+
+// ValidateImage sniffs, size-checks and fully decodes data so only real images in the allowlist get through
+func ValidateImage(data []byte) (ImageInfo, *UploadError) {
+	limits := config.Upload
+	if len(data) == 0 {
+		return ImageInfo{}, &UploadError{Status: http.StatusBadRequest, Code: "empty_file", Message: "Uploaded file is empty"}
+	}
+	if int64(len(data)) > limits.MaxBytes {
+		return ImageInfo{}, FileTooLarge()
+	}
+
+	sniffed := http.DetectContentType(data)
+	if !limits.AllowedTypes[sniffed] {
+		return ImageInfo{}, &UploadError{
+			Status:  http.StatusUnsupportedMediaType,
+			Code:    "unsupported_media_type",
+			Message: fmt.Sprintf("Content type %s is not allowed", sniffed),
+		}
+	}
+
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return ImageInfo{}, &UploadError{Status: http.StatusUnprocessableEntity, Code: "invalid_image", Message: "File could not be read as an image"}
+	}
+	known, ok := imageFormats[format]
+	if !ok || known.contentType != sniffed {
+		return ImageInfo{}, &UploadError{Status: http.StatusUnprocessableEntity, Code: "invalid_image", Message: "Image format does not match its content"}
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width > limits.MaxWidth || cfg.Height > limits.MaxHeight {
+		return ImageInfo{}, &UploadError{
+			Status:  http.StatusUnprocessableEntity,
+			Code:    "dimensions_exceeded",
+			Message: fmt.Sprintf("Image is %dx%d; the maximum is %dx%d", cfg.Width, cfg.Height, limits.MaxWidth, limits.MaxHeight),
+		}
+	}
+	// A small, highly compressed file can declare a huge canvas, so bound the decode from the header
+	if int64(cfg.Width)*int64(cfg.Height) > limits.MaxPixels {
+		return ImageInfo{}, &UploadError{
+			Status:  http.StatusUnprocessableEntity,
+			Code:    "dimensions_exceeded",
+			Message: fmt.Sprintf("Image has %d pixels; the maximum is %d", int64(cfg.Width)*int64(cfg.Height), limits.MaxPixels),
+		}
+	}
+
+	// Decoding the whole file catches truncated or corrupt images that have a valid header
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return ImageInfo{}, &UploadError{Status: http.StatusUnprocessableEntity, Code: "corrupt_image", Message: "Image data is corrupt or truncated"}
+	}
+
+	return ImageInfo{
+		ContentType: sniffed,
+		Format:      format,
+		Extension:   known.extension,
+		Width:       cfg.Width,
+		Height:      cfg.Height,
+		Size:        int64(len(data)),
+		Image:       img,
+	}, nil
+}
+
+func FileTooLarge() *UploadError {
+	return &UploadError{
+		Status:  http.StatusRequestEntityTooLarge,
+		Code:    "file_too_large",
+		Message: fmt.Sprintf("File exceeds the maximum size of %d bytes", config.Upload.MaxBytes),
+	}
+}
+
+// ResizeImage scales img so its longest edge is at most maxEdge; it never upscales
+func ResizeImage(img image.Image, maxEdge int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if maxEdge <= 0 || (w <= maxEdge && h <= maxEdge) {
+		return img
+	}
+
+	if w >= h {
+		h = max(1, h*maxEdge/w)
+		w = maxEdge
+	} else {
+		w = max(1, w*maxEdge/h)
+		h = maxEdge
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, b, draw.Over, nil)
+	return dst
+}
+
+// EncodeImage writes img as jpeg, png or webp and returns the matching content type and extension.
+// Other formats (gif) are re-encoded as png.
+func EncodeImage(w io.Writer, img image.Image, format string) (string, string, error) {
+	switch format {
+	case "jpeg":
+		return "image/jpeg", ".jpg", jpeg.Encode(w, img, &jpeg.Options{Quality: 85})
+	case "webp":
+		return "image/webp", ".webp", nativewebp.Encode(w, img, nil)
+	default:
+		return "image/png", ".png", png.Encode(w, img)
+	}
+}
+
+// ShrinkForModel decodes data, scales it so its longest edge is at most maxEdge and returns it
+// as JPEG, flattened onto white, which every vision model accepts
+func ShrinkForModel(data []byte, maxEdge int) ([]byte, string, error) {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", err
+	}
+	img = ResizeImage(img, maxEdge)
+
+	flat := image.NewRGBA(img.Bounds())
+	draw.Draw(flat, flat.Bounds(), &image.Uniform{C: color.White}, image.Point{}, draw.Src)
+	draw.Draw(flat, flat.Bounds(), img, img.Bounds().Min, draw.Over)
+
+	var buf bytes.Buffer
+	contentType, _, err := EncodeImage(&buf, flat, "jpeg")
+	if err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), contentType, nil
+}
@@ -0,0 +1,91 @@
+package helpers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	database "github.com/sachinggsingh/notify/internal/db"
+	"github.com/sachinggsingh/notify/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	TokenPurposeVerifyEmail   = "verify_email"
+	TokenPurposeResetPassword = "reset_password"
+)
+
+var ErrInvalidUserToken = errors.New("token is invalid or has expired")
+
+var userTokenCollection *mongo.Collection = database.OpenCollection(database.Client, "user_token")
+
+// CreateUserToken issues a single-use token and replaces any unused one with the same purpose.
+// Only a hash of the token is stored.
+func CreateUserToken(ctx context.Context, userID, purpose string, ttl time.Duration) (string, error) {
+	raw, err := RandomString(32)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := userTokenCollection.DeleteMany(ctx, bson.M{"user_id": userID, "purpose": purpose, "used_at": nil}); err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	_, err = userTokenCollection.InsertOne(ctx, models.UserToken{
+		ID:        primitive.NewObjectID(),
+		TokenHash: hashUserToken(raw),
+		User_id:   userID,
+		Purpose:   purpose,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	})
+	if err != nil {
+		return "", err
+	}
+	return raw, nil
+}
+
+// ConsumeUserToken marks the token used and returns its user_id
+func ConsumeUserToken(ctx context.Context, raw, purpose string) (string, error) {
+	now := time.Now()
+	filter := bson.M{
+		"token_hash": hashUserToken(raw),
+		"purpose":    purpose,
+		"used_at":    nil,
+		"expires_at": bson.M{"$gt": now},
+	}
+	var token models.UserToken
+	err := userTokenCollection.FindOneAndUpdate(ctx, filter, bson.M{"$set": bson.M{"used_at": now}}).Decode(&token)
+	if err == mongo.ErrNoDocuments {
+		return "", ErrInvalidUserToken
+	}
+	if err != nil {
+		return "", err
+	}
+	return token.User_id, nil
+}
+
+func DeleteUserTokens(ctx context.Context, userID string) error {
+	_, err := userTokenCollection.DeleteMany(ctx, bson.M{"user_id": userID})
+	return err
+}
+
+// EnsureUserTokenIndexes lets Mongo purge expired tokens and keeps lookups by hash fast
+func EnsureUserTokenIndexes(ctx context.Context) error {
+	_, err := userTokenCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "token_hash", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	return err
+}
+
+func hashUserToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
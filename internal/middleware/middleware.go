@@ -1,11 +1,18 @@
 package middleware
 
 import (
+	"context"
+	"log"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/sachinggsingh/notify/internal/config"
 	helper "github.com/sachinggsingh/notify/internal/helpers"
+	"github.com/sachinggsingh/notify/internal/models"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 func Authenticate() gin.HandlerFunc {
@@ -35,8 +42,65 @@ func Authenticate() gin.HandlerFunc {
 			return
 		}
 
+		// Tokens of disabled or deleted users stay valid until expiry, so check the revocation list
+		// and whether the user's sessions were ended after this token was issued
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		state, err := config.RDB.MGet(ctx, config.RevokedUserKey(claims.UserID), config.SessionGenerationKey(claims.UserID)).Result()
+		if err != nil {
+			log.Println("Revocation check failed:", err)
+		} else {
+			if state[0] != nil {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Account is disabled"})
+				c.Abort()
+				return
+			}
+			if gen, ok := state[1].(string); ok && sessionEnded(gen, claims.Session) {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Session has ended, please log in again"})
+				c.Abort()
+				return
+			}
+		}
+
+		// The role in the token may be stale; an admin who has since been demoted must not keep
+		// admin access until the token expires, so admin tokens are checked against the stored user
+		role := claims.Role
+		if role == models.RoleAdmin {
+			user, err := helper.FindUser(ctx, claims.UserID)
+			if err == mongo.ErrNoDocuments {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "user not found"})
+				c.Abort()
+				return
+			}
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check user role"})
+				c.Abort()
+				return
+			}
+			role = config.RoleFor(user)
+		}
+
 		c.Set("email", claims.Email)
 		c.Set("uid", claims.UserID)
+		c.Set("role", role)
+		c.Next()
+	}
+}
+
+// sessionEnded reports whether a token issued in session generation session is older than gen
+func sessionEnded(gen string, session int64) bool {
+	current, err := strconv.ParseInt(gen, 10, 64)
+	return err == nil && session < current
+}
+
+// RequireAdmin must run after Authenticate
+func RequireAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetString("role") != models.RoleAdmin {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Admin access required"})
+			c.Abort()
+			return
+		}
 		c.Next()
 	}
 }
@@ -0,0 +1,96 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sachinggsingh/notify/internal/config"
+)
+
+// RateLimit applies the token buckets configured for name. Register it after
+// Authenticate when the rules include a user scope.
+func RateLimit(name string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rules := config.RateLimits[name]
+		if len(rules) == 0 {
+			c.Next()
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+
+		var tightest *config.RateLimitResult
+		for _, rule := range rules {
+			id := rateLimitIdentity(c, rule.Scope)
+			if id == "" {
+				continue
+			}
+
+			result, err := rule.Take(ctx, "ratelimit:"+name+":"+rule.Scope+":"+id)
+			if err != nil {
+				// Fail open: an unavailable Redis should not take the API down
+				log.Println("Rate limiter error:", err)
+				continue
+			}
+			if tightest == nil || !result.Allowed || (tightest.Allowed && result.Remaining < tightest.Remaining) {
+				r := result
+				tightest = &r
+			}
+			if !result.Allowed {
+				break
+			}
+		}
+
+		if tightest == nil {
+			c.Next()
+			return
+		}
+
+		c.Header("RateLimit-Limit", strconv.Itoa(tightest.Limit))
+		c.Header("RateLimit-Remaining", strconv.Itoa(tightest.Remaining))
+		c.Header("RateLimit-Reset", strconv.Itoa(ceilSeconds(tightest.Reset)))
+
+		if !tightest.Allowed {
+			c.Header("Retry-After", strconv.Itoa(ceilSeconds(tightest.RetryAfter)))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Rate limit exceeded"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+func rateLimitIdentity(c *gin.Context, scope string) string {
+	switch scope {
+	case "route":
+		return "all"
+	case "user":
+		return c.GetString("uid")
+	case "ip":
+		return c.ClientIP()
+	case "key":
+		key := c.GetHeader("X-API-Key")
+		if key == "" {
+			return ""
+		}
+		// Keep raw keys out of Redis key names
+		sum := sha256.Sum256([]byte(key))
+		return hex.EncodeToString(sum[:8])
+	}
+	return ""
+}
+
+func ceilSeconds(d time.Duration) int {
+	if d <= 0 {
+		return 0
+	}
+	return int(math.Ceil(d.Seconds()))
+}
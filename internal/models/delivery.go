@@ -0,0 +1,292 @@
+package models
+
+import (
+	"encoding/json"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// InflightStore keeps unacknowledged QoS 1 deliveries per session so they can be
+// redelivered when the client reconnects, possibly to another replica
+type InflightStore interface {
+	Save(session, deliveryID string, message []byte) error
+	Remove(session, deliveryID string) error
+	Load(session string) (map[string][]byte, error)
+}
+
+type QoSOptions struct {
+	Session    string        // identifies the subscriber across reconnects
+	Window     int           // unacknowledged deliveries allowed at once
+	AckTimeout time.Duration // redeliver when no ack arrives in time
+}
+
+// qosState tracks a QoS 1 connection. Every message is wrapped in a deliver frame with a
+// delivery ID and stays inflight until the client acks it.
+type qosState struct {
+	QoSOptions
+	store   InflightStore
+	control chan []byte   // replies, which are not acknowledged
+	acked   chan struct{} // wakes WritePump when the window opens
+
+	mu       sync.Mutex
+	inflight map[string]*inflightDelivery
+
+	// backlog holds deliveries restored by resume that did not fit in the window. Only
+	// WritePump touches it.
+	backlog []storedDelivery
+}
+
+type storedDelivery struct {
+	id      string
+	message []byte
+}
+
+type inflightDelivery struct {
+	message []byte
+	sentAt  time.Time
+}
+
+// EnableQoS switches the client to acknowledged delivery. Call it before registering the client.
+func (c *Client) EnableQoS(opts QoSOptions) {
+	if opts.Window <= 0 {
+		opts.Window = 1
+	}
+	c.qos = &qosState{
+		QoSOptions: opts,
+		store:      c.Hub.Inflight,
+		control:    make(chan []byte, 16),
+		acked:      make(chan struct{}, 1),
+		inflight:   make(map[string]*inflightDelivery),
+	}
+}
+
+func (q *qosState) full() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.inflight) >= q.Window
+}
+
+func (q *qosState) ack(deliveryID string) bool {
+	q.mu.Lock()
+	_, ok := q.inflight[deliveryID]
+	delete(q.inflight, deliveryID)
+	q.mu.Unlock()
+	if !ok {
+		return false
+	}
+	q.forget(deliveryID)
+	select {
+	case q.acked <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// forget drops a delivery from the session store
+func (q *qosState) forget(deliveryID string) {
+	if q.store == nil {
+		return
+	}
+	if err := q.store.Remove(q.Session, deliveryID); err != nil {
+		log.Println("Failed to remove delivery:", err)
+	}
+}
+
+// expiredPayload reports whether a broadcast message has passed its expires_at, so it is not replayed
+func expiredPayload(message []byte, now time.Time) bool {
+	var m struct {
+		ExpiresAt *time.Time `json:"expires_at"`
+	}
+	return json.Unmarshal(message, &m) == nil && m.ExpiresAt != nil && !m.ExpiresAt.After(now)
+}
+
+// park persists a message that was never written so the next connection delivers it
+func (q *qosState) park(message []byte) {
+	if q.store == nil {
+		return
+	}
+	if err := q.store.Save(q.Session, primitive.NewObjectID().Hex(), message); err != nil {
+		log.Println("Failed to save undelivered message:", err)
+	}
+}
+
+// deliver writes message as a new delivery
+func (c *Client) deliver(message []byte) error {
+	q := c.qos
+	id := primitive.NewObjectID().Hex()
+	if q.store != nil {
+		if err := q.store.Save(q.Session, id, message); err != nil {
+			log.Println("Failed to save inflight delivery:", err)
+		}
+	}
+	q.mu.Lock()
+	q.inflight[id] = &inflightDelivery{message: message, sentAt: time.Now()}
+	q.mu.Unlock()
+	return c.writeDelivery(id, message, false)
+}
+
+func (c *Client) writeDelivery(id string, message []byte, redelivered bool) error {
+	data, err := json.Marshal(ServerFrame{Type: "deliver", DeliveryID: id, Message: message, Redelivered: redelivered})
+	if err != nil {
+		return err
+	}
+	c.Conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	return c.Conn.WriteMessage(websocket.TextMessage, data)
+}
+
+// redeliverDue resends deliveries whose ack timed out
+func (c *Client) redeliverDue() error {
+	q := c.qos
+	now := time.Now()
+	var due []string
+	var expired []string
+	q.mu.Lock()
+	for id, d := range q.inflight {
+		if now.Sub(d.sentAt) < q.AckTimeout {
+			continue
+		}
+		if expiredPayload(d.message, now) {
+			delete(q.inflight, id)
+			expired = append(expired, id)
+			continue
+		}
+		d.sentAt = now
+		due = append(due, id)
+	}
+	q.mu.Unlock()
+	for _, id := range expired {
+		q.forget(id)
+	}
+	sort.Strings(due) // delivery IDs are ObjectIDs, so this is send order
+
+	for _, id := range due {
+		q.mu.Lock()
+		d, ok := q.inflight[id]
+		q.mu.Unlock()
+		if !ok {
+			continue
+		}
+		if err := c.writeDelivery(id, d.message, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resume queues what the session left unacknowledged on its previous connection, oldest first,
+// and redelivers as much of it as the window allows
+func (c *Client) resume() error {
+	q := c.qos
+	if q.store == nil {
+		return nil
+	}
+	pending, err := q.store.Load(q.Session)
+	if err != nil {
+		log.Println("Failed to load inflight deliveries:", err)
+		return nil
+	}
+	ids := make([]string, 0, len(pending))
+	for id := range pending {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		q.backlog = append(q.backlog, storedDelivery{id: id, message: pending[id]})
+	}
+	return c.redeliverBacklog()
+}
+
+// redeliverBacklog sends restored deliveries while the window has room. They stay in the store
+// until acked, so whatever is left over survives another reconnect.
+func (c *Client) redeliverBacklog() error {
+	q := c.qos
+	for len(q.backlog) > 0 && !q.full() {
+		d := q.backlog[0]
+		q.backlog[0] = storedDelivery{}
+		q.backlog = q.backlog[1:]
+		if expiredPayload(d.message, time.Now()) {
+			q.forget(d.id)
+			continue
+		}
+		q.mu.Lock()
+		q.inflight[d.id] = &inflightDelivery{message: d.message, sentAt: time.Now()}
+		q.mu.Unlock()
+		if err := c.writeDelivery(d.id, d.message, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeQoS is WritePump for QoS 1 connections: no batching, and Send is only read while
+// the inflight window has room, so urgent messages overtake queued bulk ones
+func (c *Client) writeQoS(ping <-chan time.Time) {
+	q := c.qos
+	defer func() {
+		// Keep whatever was queued but never written for the next connection
+		for {
+			message, ok := c.Send.Pop()
+			if !ok {
+				break
+			}
+			q.park(message)
+		}
+	}()
+
+	if err := c.resume(); err != nil {
+		return
+	}
+	tick := time.NewTicker(time.Second)
+	defer tick.Stop()
+
+	for {
+		if err := c.redeliverBacklog(); err != nil {
+			return
+		}
+		// Restored deliveries go out before anything new
+		ready := c.Send.Ready()
+		if q.full() || len(q.backlog) > 0 {
+			ready = nil
+		}
+		select {
+		case <-ready:
+			message, ok := c.Send.Pop()
+			if !ok {
+				if c.Send.Closed() {
+					return
+				}
+				continue
+			}
+			if err := c.deliver(message); err != nil {
+				return
+			}
+		case reply := <-q.control:
+			c.Conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+			if err := c.Conn.WriteMessage(websocket.TextMessage, reply); err != nil {
+				return
+			}
+		case <-q.acked:
+		case <-tick.C:
+			// A full window stops us reading Send, so notice a hub disconnect here
+			c.Hub.Mutex.RLock()
+			registered := c.Hub.Clients[c]
+			c.Hub.Mutex.RUnlock()
+			if !registered {
+				return
+			}
+			if err := c.redeliverDue(); err != nil {
+				return
+			}
+		case <-ping:
+			c.Conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+			if err := c.Conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,266 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type memInflight struct {
+	mu       sync.Mutex
+	sessions map[string]map[string][]byte
+}
+
+func newMemInflight() *memInflight {
+	return &memInflight{sessions: make(map[string]map[string][]byte)}
+}
+
+func (s *memInflight) Save(session, deliveryID string, message []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.sessions[session] == nil {
+		s.sessions[session] = make(map[string][]byte)
+	}
+	s.sessions[session][deliveryID] = message
+	return nil
+}
+
+func (s *memInflight) Remove(session, deliveryID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions[session], deliveryID)
+	return nil
+}
+
+func (s *memInflight) Load(session string) (map[string][]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make(map[string][]byte, len(s.sessions[session]))
+	for id, message := range s.sessions[session] {
+		out[id] = message
+	}
+	return out, nil
+}
+
+func (s *memInflight) count(session string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.sessions[session])
+}
+
+// qosHarness runs writeQoS for one client over a real WebSocket and collects what the peer reads
+type qosHarness struct {
+	client *Client
+	frames chan ServerFrame
+	done   chan struct{}
+}
+
+func startQoS(t *testing.T, store InflightStore, opts QoSOptions) *qosHarness {
+	t.Helper()
+	serverConns := make(chan *websocket.Conn, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		serverConns <- conn
+	}))
+	t.Cleanup(srv.Close)
+
+	peer, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { peer.Close() })
+
+	hub := &Hub{Clients: make(map[*Client]bool), Inflight: store}
+	c := &Client{Conn: <-serverConns, Send: NewSendQueue(16), Hub: hub}
+	c.EnableQoS(opts)
+	hub.Clients[c] = true
+
+	h := &qosHarness{client: c, frames: make(chan ServerFrame, 64), done: make(chan struct{})}
+	go func() {
+		for {
+			_, data, err := peer.ReadMessage()
+			if err != nil {
+				close(h.frames)
+				return
+			}
+			var frame ServerFrame
+			if err := json.Unmarshal(data, &frame); err != nil {
+				t.Error(err)
+			}
+			h.frames <- frame
+		}
+	}()
+	go func() {
+		c.writeQoS(nil)
+		close(h.done)
+	}()
+	t.Cleanup(h.stop)
+	return h
+}
+
+func (h *qosHarness) next(t *testing.T) ServerFrame {
+	t.Helper()
+	select {
+	case frame := <-h.frames:
+		return frame
+	case <-time.After(3 * time.Second):
+		t.Fatal("no frame received")
+		return ServerFrame{}
+	}
+}
+
+func (h *qosHarness) nothing(t *testing.T, wait time.Duration) {
+	t.Helper()
+	select {
+	case frame := <-h.frames:
+		t.Fatalf("unexpected frame %+v", frame)
+	case <-time.After(wait):
+	}
+}
+
+// stop unregisters the client, which writeQoS notices on its next tick
+func (h *qosHarness) stop() {
+	h.client.Hub.Mutex.Lock()
+	delete(h.client.Hub.Clients, h.client)
+	h.client.Hub.Mutex.Unlock()
+	h.client.Send.Close()
+	<-h.done
+}
+
+func payload(content string, expiresAt *time.Time) []byte {
+	data, _ := json.Marshal(Message{UserID: "u1", Content: content, ExpiresAt: expiresAt})
+	return data
+}
+
+func contentOf(t *testing.T, frame ServerFrame) string {
+	t.Helper()
+	var m Message
+	if err := json.Unmarshal(frame.Message, &m); err != nil {
+		t.Fatal(err)
+	}
+	return m.Content
+}
+
+func TestExpiredPayload(t *testing.T) {
+	now := time.Now()
+	past, future := now.Add(-time.Minute), now.Add(time.Minute)
+	tests := []struct {
+		name    string
+		message []byte
+		want    bool
+	}{
+		{"no expiry", payload("a", nil), false},
+		{"expired", payload("a", &past), true},
+		{"expires exactly now", payload("a", &now), true},
+		{"not yet expired", payload("a", &future), false},
+		{"not json", []byte("hello"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := expiredPayload(tt.message, now); got != tt.want {
+				t.Errorf("expiredPayload() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQoSResumeRespectsWindow(t *testing.T) {
+	store := newMemInflight()
+	past := time.Now().Add(-time.Minute)
+	base := time.Now().Add(-time.Hour)
+	for i := range 5 {
+		id := primitive.NewObjectIDFromTimestamp(base.Add(time.Duration(i) * time.Second)).Hex()
+		var expires *time.Time
+		if i == 1 {
+			expires = &past
+		}
+		store.Save("u1:tab", id, payload(fmt.Sprint("m", i), expires))
+	}
+
+	h := startQoS(t, store, QoSOptions{Session: "u1:tab", Window: 2, AckTimeout: time.Hour})
+
+	// m1 has expired, so the window of two holds m0 and m2
+	first, second := h.next(t), h.next(t)
+	if contentOf(t, first) != "m0" || contentOf(t, second) != "m2" {
+		t.Fatalf("resumed %q and %q, want m0 and m2", contentOf(t, first), contentOf(t, second))
+	}
+	if !first.Redelivered || !second.Redelivered {
+		t.Error("resumed deliveries are not marked redelivered")
+	}
+	h.nothing(t, 200*time.Millisecond)
+
+	// New messages wait behind the restored ones
+	h.client.Send.Push(payload("new", nil), 0)
+	h.client.qos.ack(first.DeliveryID)
+	if got := contentOf(t, h.next(t)); got != "m3" {
+		t.Fatalf("after one ack got %q, want m3", got)
+	}
+	h.client.qos.ack(second.DeliveryID)
+	if got := contentOf(t, h.next(t)); got != "m4" {
+		t.Fatalf("after two acks got %q, want m4", got)
+	}
+	h.nothing(t, 200*time.Millisecond)
+}
+
+func TestQoSAckAndRedelivery(t *testing.T) {
+	store := newMemInflight()
+	h := startQoS(t, store, QoSOptions{Session: "u1:tab", Window: 4, AckTimeout: 100 * time.Millisecond})
+
+	h.client.Send.Push(payload("kept", nil), 0)
+	h.client.Send.Push(payload("acked", nil), 0)
+	kept, acked := h.next(t), h.next(t)
+	if kept.Type != "deliver" || kept.Redelivered || kept.DeliveryID == "" {
+		t.Fatalf("first delivery = %+v", kept)
+	}
+	if n := store.count("u1:tab"); n != 2 {
+		t.Fatalf("store holds %d deliveries, want 2", n)
+	}
+	if !h.client.qos.ack(acked.DeliveryID) {
+		t.Fatal("ack of an inflight delivery failed")
+	}
+	if h.client.qos.ack(acked.DeliveryID) {
+		t.Error("second ack of the same delivery succeeded")
+	}
+	if h.client.qos.ack("unknown") {
+		t.Error("ack of an unknown delivery succeeded")
+	}
+
+	// Only the unacknowledged delivery comes back, under the same ID
+	again := h.next(t)
+	if again.DeliveryID != kept.DeliveryID || !again.Redelivered || contentOf(t, again) != "kept" {
+		t.Fatalf("redelivery = %+v, want %s redelivered", again, kept.DeliveryID)
+	}
+	h.client.qos.ack(kept.DeliveryID)
+	if n := store.count("u1:tab"); n != 0 {
+		t.Errorf("store holds %d deliveries after all acks, want 0", n)
+	}
+	h.nothing(t, 1200*time.Millisecond)
+}
+
+func TestQoSWindowHoldsBackNewMessages(t *testing.T) {
+	h := startQoS(t, newMemInflight(), QoSOptions{Session: "u1:tab", Window: 1, AckTimeout: time.Hour})
+
+	h.client.Send.Push(payload("bulk", nil), 0)
+	first := h.next(t)
+	h.client.Send.Push(payload("more bulk", nil), 0)
+	h.client.Send.Push(payload("urgent", nil), MaxPriority)
+	h.nothing(t, 200*time.Millisecond)
+
+	// With the window full, the urgent message overtakes the bulk one queued before it
+	h.client.qos.ack(first.DeliveryID)
+	if got := contentOf(t, h.next(t)); got != "urgent" {
+		t.Fatalf("got %q, want urgent", got)
+	}
+}
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"encoding/json"
 	"log"
 	"sync"
 	"time"
@@ -20,15 +21,151 @@ type User struct {
 	CreatedAt     time.Time          `json:"created_at" bson:"created_at"`
 	UpdatedAt     time.Time          `json:"updated_at" bson:"updated_at"`
 	User_id       string             `json:"user_id" bson:"user_id"`
+	OIDCIssuer    string             `json:"oidc_issuer,omitempty" bson:"oidc_issuer,omitempty"`
+	OIDCSubject   string             `json:"oidc_subject,omitempty" bson:"oidc_subject,omitempty"`
+	Verified      bool               `json:"verified" bson:"verified"`
+	FailedLogins  int                `json:"-" bson:"failed_logins"`
+	LockedUntil   *time.Time         `json:"-" bson:"locked_until,omitempty"`
+	Name          string             `json:"name" bson:"name"`
+	Role          string             `json:"role" bson:"role"`
+	Disabled      bool               `json:"disabled" bson:"disabled"`
+}
+
+const (
+	RoleUser  = "USER"
+	RoleAdmin = "ADMIN"
+)
+
+// Single-use token for email verification and password reset
+type UserToken struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	TokenHash string             `bson:"token_hash" json:"-"`
+	User_id   string             `bson:"user_id" json:"user_id"`
+	Purpose   string             `bson:"purpose" json:"purpose"`
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+	ExpiresAt time.Time          `bson:"expires_at" json:"expires_at"`
+	UsedAt    *time.Time         `bson:"used_at,omitempty" json:"used_at,omitempty"`
 }
 
 // UploadData model
 type Image struct {
-	ID       primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
-	URL      string             `bson:"url" json:"url"`
-	PublicID string             `bson:"public_id" json:"public_id"`
-	Uploaded time.Time          `bson:"uploaded" json:"uploaded"`
-	Image_id string             `json:"image_id" validate:"required"`
+	ID       primitive.ObjectID      `bson:"_id,omitempty" json:"id,omitempty"`
+	URL      string                  `bson:"url" json:"url"`
+	PublicID string                  `bson:"public_id" json:"public_id"`
+	Uploaded time.Time               `bson:"uploaded" json:"uploaded"`
+	Image_id string                  `json:"image_id" validate:"required"`
+	OwnerID  string                  `bson:"owner_id,omitempty" json:"owner_id,omitempty"`
+	Variants map[string]ImageVariant `bson:"variants,omitempty" json:"variants,omitempty"`
+	Filename string                  `bson:"filename,omitempty" json:"filename,omitempty"`
+	Topic    string                  `bson:"topic,omitempty" json:"topic,omitempty"`
+
+	// Filled in by the background caption job
+	CaptionStatus   string     `bson:"caption_status,omitempty" json:"caption_status,omitempty"`
+	CaptionLocale   string     `bson:"caption_locale,omitempty" json:"caption_locale,omitempty"`
+	CaptionTemplate string     `bson:"caption_template,omitempty" json:"caption_template,omitempty"`
+	Caption         string     `bson:"caption,omitempty" json:"caption,omitempty"`
+	CaptionError    string     `bson:"caption_error,omitempty" json:"caption_error,omitempty"`
+	CaptionAttempts int        `bson:"caption_attempts,omitempty" json:"caption_attempts,omitempty"`
+	CaptionedAt     *time.Time `bson:"captioned_at,omitempty" json:"captioned_at,omitempty"`
+	// CaptionAnnounced is false between recording the final caption status and publishing the
+	// upload message, so a retried job only repeats the announcement
+	CaptionAnnounced *bool `bson:"caption_announced,omitempty" json:"-"`
+
+	// Structured description from the same model, used for search and accessibility
+	Tags    []string `bson:"tags,omitempty" json:"tags,omitempty"`
+	Objects []string `bson:"objects,omitempty" json:"objects,omitempty"`
+	AltText string   `bson:"alt_text,omitempty" json:"alt_text,omitempty"`
+
+	// "held" while the upload notification waits for review, then "approved" or "rejected"
+	ModerationStatus string `bson:"moderation_status,omitempty" json:"moderation_status,omitempty"`
+}
+
+// Caption prompt editable at runtime. A template with a Topic is used for images uploaded to
+// that topic; otherwise the one named "default", otherwise the built-in prompt.
+type PromptTemplate struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"-"`
+	Name        string             `bson:"name" json:"name"`
+	Topic       string             `bson:"topic,omitempty" json:"topic,omitempty"`
+	Template    string             `bson:"template" json:"template" validate:"required"`
+	Temperature *float64           `bson:"temperature,omitempty" json:"temperature,omitempty" validate:"omitempty,gte=0,lte=2"`
+	MaxTokens   *int               `bson:"max_tokens,omitempty" json:"max_tokens,omitempty" validate:"omitempty,gt=0,lte=4096"`
+	UpdatedAt   time.Time          `bson:"updated_at" json:"updated_at"`
+	UpdatedBy   string             `bson:"updated_by" json:"updated_by"`
+}
+
+// Content the moderator flagged, waiting for an admin decision
+type ReviewItem struct {
+	ID      primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Kind    string             `bson:"kind" json:"kind"` // "message" or "image"
+	Status  string             `bson:"status" json:"status"`
+	UserID  string             `bson:"user_id" json:"user_id"`
+	ImageID string             `bson:"image_id,omitempty" json:"image_id,omitempty"`
+	Message Message            `bson:"message" json:"message"` // broadcast if approved
+	// DeliverAt keeps the schedule of a held scheduled message, which Message does not store
+	DeliverAt  *time.Time `bson:"deliver_at,omitempty" json:"deliver_at,omitempty"`
+	Provider   string     `bson:"provider" json:"provider"`
+	Categories []string   `bson:"categories,omitempty" json:"categories,omitempty"`
+	Reason     string     `bson:"reason,omitempty" json:"reason,omitempty"`
+	CreatedAt  time.Time  `bson:"created_at" json:"created_at"`
+	ReviewedAt *time.Time `bson:"reviewed_at,omitempty" json:"reviewed_at,omitempty"`
+	ReviewedBy string     `bson:"reviewed_by,omitempty" json:"reviewed_by,omitempty"`
+	Note       string     `bson:"note,omitempty" json:"note,omitempty"`
+}
+
+const (
+	ReviewMessage = "message"
+	ReviewImage   = "image"
+
+	ReviewPending  = "pending"
+	ReviewApproved = "approved"
+	ReviewRejected = "rejected"
+)
+
+const (
+	CaptionPending = "pending"
+	CaptionDone    = "done"
+	CaptionFailed  = "failed"
+)
+
+// Derived copy of an uploaded image, e.g. a thumbnail
+type ImageVariant struct {
+	Key         string `bson:"key" json:"-"`
+	URL         string `bson:"url" json:"url"`
+	Width       int    `bson:"width" json:"width"`
+	Height      int    `bson:"height" json:"height"`
+	ContentType string `bson:"content_type" json:"content_type"`
+	Size        int64  `bson:"size" json:"size"`
+}
+
+// Resumable upload in progress; chunks are kept in UploadChunk until finalize
+type UploadSession struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"-"`
+	UploadID  string             `bson:"upload_id" json:"upload_id"`
+	OwnerID   string             `bson:"owner_id" json:"owner_id"`
+	Filename  string             `bson:"filename,omitempty" json:"filename,omitempty"`
+	PublicID  string             `bson:"public_id,omitempty" json:"public_id,omitempty"`
+	Topic     string             `bson:"topic,omitempty" json:"topic,omitempty"`
+	Locale    string             `bson:"locale,omitempty" json:"locale,omitempty"`
+	Size      int64              `bson:"size" json:"size"`
+	Offset    int64              `bson:"offset" json:"offset"`
+	Status    string             `bson:"status" json:"status"`
+	ImageID   string             `bson:"image_id,omitempty" json:"image_id,omitempty"`
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt time.Time          `bson:"updated_at" json:"updated_at"`
+	ExpiresAt time.Time          `bson:"expires_at" json:"expires_at"`
+}
+
+const (
+	UploadPending    = "pending"
+	UploadFinalizing = "finalizing"
+	UploadCompleted  = "completed"
+)
+
+type UploadChunk struct {
+	UploadID  string    `bson:"upload_id"`
+	Offset    int64     `bson:"offset"`
+	Data      []byte    `bson:"data"`
+	ExpiresAt time.Time `bson:"expires_at"`
 }
 
 // TokenResponse model
@@ -42,23 +179,120 @@ type TokenResponse struct {
 type SignedDetails struct {
 	Email  string
 	UserID string
+	Role   string
+	// Session is the user's session generation when the token was issued
+	Session int64 `json:",omitempty"`
+	jwt.RegisteredClaims
+}
+
+// Cross-replica control events sent on the Redis "control" channel
+type ControlEvent struct {
+	Type   string `json:"type"`
+	UserID string `json:"user_id"`
+}
+
+// ID token claims issued by an external OIDC provider
+type IDTokenClaims struct {
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	Name          string `json:"name"`
+	Nonce         string `json:"nonce"`
 	jwt.RegisteredClaims
 }
 
 type Message struct {
-	UserID    string         `json:"user_id" validate:"required"`
-	Content   string         `json:"content" validate:"required"`
-	Timestamp time.Time      `json:"timestamp"`
-	Metadata  map[string]any `json:"metadata,omitempty"`
+	ID        primitive.ObjectID `json:"id,omitzero" bson:"_id,omitempty"`
+	Type      string             `json:"type,omitempty" bson:"type,omitempty"`
+	Topic     string             `json:"topic,omitempty" bson:"topic,omitempty"`
+	UserID    string             `json:"user_id" validate:"required"`
+	Content   string             `json:"content" validate:"required"`
+	Timestamp time.Time          `json:"timestamp"`
+	Metadata  map[string]any     `json:"metadata,omitempty"`
+	// ReplyTo is the message this one answers; ThreadID is the first message of that thread
+	ReplyTo  primitive.ObjectID `json:"reply_to,omitzero" bson:"reply_to,omitempty"`
+	ThreadID primitive.ObjectID `json:"thread_id,omitzero" bson:"thread_id,omitempty"`
+	// Reactions are emoji counts, filled in when messages are read back
+	Reactions map[string]int64 `json:"reactions,omitempty" bson:"-"`
+	// AuthorID is the authenticated user who published the message; only they or an admin may change it
+	AuthorID  string     `json:"author_id,omitempty" bson:"author_id,omitempty"`
+	EditedAt  *time.Time `json:"edited_at,omitempty" bson:"edited_at,omitempty"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty" bson:"deleted_at,omitempty"` // set on tombstones
+	Priority  int        `json:"priority,omitempty" bson:"priority,omitempty" validate:"gte=0,lte=9"`
+	// Retain keeps the message as its topic's last value, sent to every new subscriber
+	Retain bool `json:"retain,omitempty" bson:"retain,omitempty"`
+	// ExpiresAt stops broadcast and replay after that time; publishers may send ttl (seconds) instead
+	ExpiresAt *time.Time `json:"expires_at,omitempty" bson:"expires_at,omitempty"`
+	TTL       int64      `json:"ttl,omitempty" bson:"-" validate:"gte=0"`
+	// DeliverAt or Delay (seconds) schedule the message instead of publishing it now
+	DeliverAt *time.Time `json:"deliver_at,omitempty" bson:"-"`
+	Delay     int64      `json:"delay,omitempty" bson:"-" validate:"gte=0"`
+}
+
+// Expired reports whether the message is past its expiry
+func (m Message) Expired(now time.Time) bool {
+	return m.ExpiresAt != nil && !m.ExpiresAt.After(now)
+}
+
+// ClearServerFields drops the fields a publisher may not set. Type marks system events such as
+// "message.deleted", which only the server sends.
+func (m *Message) ClearServerFields() {
+	m.ID = primitive.NilObjectID
+	m.Type = ""
+	m.EditedAt, m.DeletedAt = nil, nil
+	m.ThreadID, m.Reactions = primitive.NilObjectID, nil
+}
+
+// Reaction is one user's emoji on a message; a user can add each emoji once
+type Reaction struct {
+	MessageID primitive.ObjectID `json:"message_id" bson:"message_id"`
+	UserID    string             `json:"user_id" bson:"user_id"`
+	Emoji     string             `json:"emoji" bson:"emoji"`
+	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
+}
+
+const (
+	SchedulePending    = "pending"
+	SchedulePublishing = "publishing"
+	SchedulePublished  = "published"
+	ScheduleCancelled  = "cancelled"
+)
+
+// ScheduledMessage is a message waiting for its delivery time. ID is also the ID the message
+// is published with, so a retried publish cannot store it twice.
+type ScheduledMessage struct {
+	ID          primitive.ObjectID `json:"id" bson:"_id"`
+	OwnerID     string             `json:"owner_id" bson:"owner_id"`
+	Message     Message            `json:"message" bson:"message"`
+	DeliverAt   time.Time          `json:"deliver_at" bson:"deliver_at"`
+	Status      string             `json:"status" bson:"status"`
+	CreatedAt   time.Time          `json:"created_at" bson:"created_at"`
+	ClaimedAt   *time.Time         `json:"-" bson:"claimed_at,omitempty"`
+	PublishedAt *time.Time         `json:"published_at,omitempty" bson:"published_at,omitempty"`
+}
+
+// RetentionPolicy bounds how long, or how many, messages are kept for one topic
+type RetentionPolicy struct {
+	Topic     string    `json:"topic" bson:"topic"`
+	MaxAge    string    `json:"max_age,omitempty" bson:"max_age,omitempty"` // Go duration, e.g. 720h
+	MaxCount  int64     `json:"max_count,omitempty" bson:"max_count,omitempty" validate:"gte=0"`
+	UpdatedAt time.Time `json:"updated_at" bson:"updated_at"`
+	UpdatedBy string    `json:"updated_by" bson:"updated_by"`
 }
 
 type Client struct {
 	ID       string
 	UserID   string
 	Conn     *websocket.Conn
-	Send     chan []byte
+	Send     *SendQueue
 	Hub      *Hub
 	LastPing time.Time
+	Limiter  FrameLimiter // inbound frame limit, nil means unlimited
+	IP       string
+	// ReadLimit is the largest inbound frame in bytes; 0 uses DefaultReadLimit
+	ReadLimit int64
+
+	subs map[string]*subscription // guarded by Hub.Mutex
+	qos  *qosState                // nil unless EnableQoS was called
 }
 
 type Hub struct {
@@ -67,6 +301,16 @@ type Hub struct {
 	Unregister chan *Client
 	Broadcast  chan []byte
 	Mutex      sync.RWMutex
+
+	// OnPublish handles publish frames; publishing over WebSocket is refused while it is nil
+	OnPublish func(c *Client, frame ClientFrame) ServerFrame
+	// Inflight persists QoS 1 deliveries across reconnects; nil keeps them per connection
+	Inflight InflightStore
+	// Retained supplies the retained messages sent to new subscribers; nil disables them
+	Retained RetainedStore
+
+	topics     *topicNode           // subscription trie, guarded by Mutex
+	unfiltered map[*Client]struct{} // clients without subscriptions receive everything
 }
 
 func (h *Hub) Run() {
@@ -74,34 +318,96 @@ func (h *Hub) Run() {
 		select {
 		case client := <-h.Register:
 			h.Mutex.Lock()
+			h.index()
 			h.Clients[client] = true
+			if len(client.subs) == 0 {
+				h.unfiltered[client] = struct{}{}
+			}
 			h.Mutex.Unlock()
 			println("Client connected:", client.ID)
 
 		case client := <-h.Unregister:
 			h.Mutex.Lock()
-			if _, ok := h.Clients[client]; ok {
-				delete(h.Clients, client)
-				close(client.Send)
-			}
+			h.remove(client)
 			h.Mutex.Unlock()
 			println("Client disconnected:", client.ID)
 
 		case message := <-h.Broadcast:
-			h.Mutex.RLock()
-			for client := range h.Clients {
-				select {
-				case client.Send <- message:
-				default:
-					close(client.Send)
-					delete(h.Clients, client)
-				}
-			}
-			h.Mutex.RUnlock()
+			h.broadcast(message)
+		}
+	}
+}
+
+// index initialises the routing index; callers hold Mutex
+func (h *Hub) index() {
+	if h.topics == nil {
+		h.topics = newTopicNode()
+		h.unfiltered = make(map[*Client]struct{})
+	}
+}
+
+// remove drops a client and its subscriptions; callers hold Mutex
+func (h *Hub) remove(client *Client) {
+	if _, ok := h.Clients[client]; !ok {
+		return
+	}
+	delete(h.Clients, client)
+	delete(h.unfiltered, client)
+	for _, sub := range client.subs {
+		h.topics.remove(sub)
+	}
+	client.Send.Close()
+}
+
+// broadcast queues message for every client with a subscription matching its topic and filter
+func (h *Hub) broadcast(message []byte) {
+	// Decode once; every subscription is evaluated against the same document
+	var doc map[string]any
+	if err := json.Unmarshal(message, &doc); err != nil {
+		log.Println("Dropping broadcast that is not a JSON object:", err)
+		return
+	}
+	topic, _ := doc["topic"].(string)
+	priority, _ := doc["priority"].(float64)
+
+	h.Mutex.Lock()
+	defer h.Mutex.Unlock()
+	h.index()
+
+	targets := make(map[*Client]struct{}, len(h.unfiltered))
+	for client := range h.unfiltered {
+		targets[client] = struct{}{}
+	}
+	h.topics.match(topic, func(sub *subscription) {
+		if _, ok := targets[sub.client]; ok {
+			return
+		}
+		if sub.filter == nil || sub.filter.Match(doc, sub.client.UserID) {
+			targets[sub.client] = struct{}{}
+		}
+	})
+
+	for client := range targets {
+		if !client.Send.Push(message, int(priority)) {
+			h.remove(client)
+		}
+	}
+}
+
+// DisconnectUser drops every connection belonging to userID on this replica
+func (h *Hub) DisconnectUser(userID string) {
+	h.Mutex.Lock()
+	defer h.Mutex.Unlock()
+	for client := range h.Clients {
+		if client.UserID == userID {
+			h.remove(client)
 		}
 	}
 }
 
+// DefaultReadLimit is the inbound frame size limit when Client.ReadLimit is unset
+const DefaultReadLimit = 64 << 10
+
 func (c *Client) WritePump() {
 	ticker := time.NewTicker(30 * time.Second)
 	defer func() {
@@ -109,12 +415,21 @@ func (c *Client) WritePump() {
 		c.Conn.Close()
 	}()
 
+	if c.qos != nil {
+		c.writeQoS(ticker.C)
+		return
+	}
+
 	for {
 		select {
-		case message, ok := <-c.Send:
+		case <-c.Send.Ready():
+			message, ok := c.Send.Pop()
 			if !ok {
-				c.Conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
-				return
+				if c.Send.Closed() {
+					c.Conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+					return
+				}
+				continue
 			}
 
 			w, err := c.Conn.NextWriter(websocket.TextMessage)
@@ -124,9 +439,14 @@ func (c *Client) WritePump() {
 
 			w.Write(message)
 
-			n := len(c.Send)
-			for i := 0; i < n; i++ {
-				w.Write(<-c.Send)
+			// Batched frames are newline-delimited JSON, most urgent first
+			for n := c.Send.Len(); n > 0; n-- {
+				next, ok := c.Send.Pop()
+				if !ok {
+					break
+				}
+				w.Write([]byte{'\n'})
+				w.Write(next)
 			}
 
 			if err := w.Close(); err != nil {
@@ -146,7 +466,11 @@ func (c *Client) ReadPump() {
 		c.Conn.Close()
 	}()
 
-	c.Conn.SetReadLimit(512)
+	limit := c.ReadLimit
+	if limit <= 0 {
+		limit = DefaultReadLimit
+	}
+	c.Conn.SetReadLimit(limit)
 	c.Conn.SetReadDeadline(time.Now().Add(60 * time.Second))
 	c.Conn.SetPongHandler(func(string) error {
 		c.LastPing = time.Now()
@@ -155,13 +479,23 @@ func (c *Client) ReadPump() {
 	})
 
 	for {
-		_, _, err := c.Conn.ReadMessage()
+		_, data, err := c.Conn.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				log.Printf("WebSocket error: %v", err)
 			}
 			break
 		}
+		if c.Limiter != nil && !c.Limiter.Allow() {
+			log.Printf("Client %s exceeded the inbound frame rate limit", c.ID)
+			c.Conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "rate limit exceeded"),
+				time.Now().Add(time.Second))
+			break
+		}
+		if reply := c.handleFrame(data); reply.Type != "" {
+			c.reply(reply)
+		}
 	}
 }
 
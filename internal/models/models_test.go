@@ -0,0 +1,69 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestMessageExpired(t *testing.T) {
+	now := time.Now()
+	at := func(d time.Duration) *time.Time {
+		t := now.Add(d)
+		return &t
+	}
+	tests := []struct {
+		name      string
+		expiresAt *time.Time
+		want      bool
+	}{
+		{"no expiry", nil, false},
+		{"in the future", at(time.Second), false},
+		{"exactly now", at(0), true},
+		{"in the past", at(-time.Second), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := (Message{ExpiresAt: tt.expiresAt}).Expired(now); got != tt.want {
+				t.Errorf("Expired() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMessageClearServerFields(t *testing.T) {
+	now := time.Now()
+	var m Message
+	err := json.Unmarshal([]byte(`{
+		"id": "64b7f0c2a1b2c3d4e5f60718",
+		"type": "message.deleted",
+		"thread_id": "64b7f0c2a1b2c3d4e5f60719",
+		"reactions": {"👍": 3},
+		"edited_at": "2026-01-01T00:00:00Z",
+		"deleted_at": "2026-01-01T00:00:00Z",
+		"user_id": "u1",
+		"content": "hello",
+		"topic": "chat",
+		"expires_at": "2099-01-01T00:00:00Z"
+	}`), &m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Type != "message.deleted" {
+		t.Fatalf("Type = %q, the client value should bind", m.Type)
+	}
+
+	m.ClearServerFields()
+	if m.Type != "" {
+		t.Errorf("Type = %q, want it removed", m.Type)
+	}
+	if !m.ID.IsZero() || !m.ThreadID.IsZero() {
+		t.Errorf("ID = %s, ThreadID = %s, want both removed", m.ID.Hex(), m.ThreadID.Hex())
+	}
+	if m.Reactions != nil || m.EditedAt != nil || m.DeletedAt != nil {
+		t.Error("reactions, edited_at or deleted_at kept")
+	}
+	if m.UserID != "u1" || m.Content != "hello" || m.Topic != "chat" || m.ExpiresAt == nil || m.Expired(now) {
+		t.Errorf("publisher fields changed: %+v", m)
+	}
+}
@@ -0,0 +1,44 @@
+package models
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// FrameLimiter decides whether a client may send another frame
+type FrameLimiter interface {
+	Allow() bool
+}
+
+// TokenBucket limits a single connection; it lives with the Client, so it needs no shared state
+type TokenBucket struct {
+	rate     float64
+	capacity float64
+	tokens   float64
+	last     time.Time
+	mu       sync.Mutex
+}
+
+func NewTokenBucket(rate float64, burst int) *TokenBucket {
+	return &TokenBucket{
+		rate:     rate,
+		capacity: float64(burst),
+		tokens:   float64(burst),
+		last:     time.Now(),
+	}
+}
+
+func (b *TokenBucket) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.tokens = math.Min(b.capacity, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
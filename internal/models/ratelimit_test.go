@@ -0,0 +1,40 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	tests := []struct {
+		name  string
+		rate  float64
+		burst int
+		sleep time.Duration // between the first burst and the retry
+		want  int           // frames allowed after the sleep
+	}{
+		{"burst then empty", 0.001, 3, 0, 0},
+		{"refills over time", 100, 2, 30 * time.Millisecond, 2},
+		{"refill capped at burst", 1000, 2, 50 * time.Millisecond, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewTokenBucket(tt.rate, tt.burst)
+			for i := range tt.burst {
+				if !b.Allow() {
+					t.Fatalf("frame %d of the initial burst refused", i)
+				}
+			}
+			time.Sleep(tt.sleep)
+			allowed := 0
+			for range tt.burst + 2 {
+				if b.Allow() {
+					allowed++
+				}
+			}
+			if allowed != tt.want {
+				t.Errorf("allowed %d after %v, want %d", allowed, tt.sleep, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package models
+
+import "sync"
+
+// Message priorities run from 0 (bulk, the default) to MaxPriority (urgent)
+const MaxPriority = 9
+
+// replyPriority puts answers to client frames ahead of every message
+const replyPriority = MaxPriority + 1
+
+// SendQueue is a client's outbound queue. Higher priorities are sent first and equal priorities
+// in arrival order. When it is full, the oldest message of the lowest priority makes room.
+type SendQueue struct {
+	mu      sync.Mutex
+	buckets [replyPriority + 1][][]byte
+	size    int
+	limit   int
+	closed  bool
+	ready   chan struct{}
+}
+
+func NewSendQueue(limit int) *SendQueue {
+	return &SendQueue{limit: limit, ready: make(chan struct{}, 1)}
+}
+
+// Push queues data. It reports false when the queue is closed, or full of messages at least as
+// urgent as this one; the hub treats that as a consumer too slow to keep.
+func (q *SendQueue) Push(data []byte, priority int) bool {
+	priority = min(max(priority, 0), replyPriority)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return false
+	}
+	if q.size >= q.limit {
+		lowest := 0
+		for lowest < priority && len(q.buckets[lowest]) == 0 {
+			lowest++
+		}
+		if lowest >= priority {
+			return false
+		}
+		q.buckets[lowest][0] = nil
+		q.buckets[lowest] = q.buckets[lowest][1:]
+		q.size--
+	}
+	q.buckets[priority] = append(q.buckets[priority], data)
+	q.size++
+	q.signal()
+	return true
+}
+
+// Pop takes the most urgent message, or reports false when the queue is empty
+func (q *SendQueue) Pop() ([]byte, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	// Keep Ready signalled while anything is left, and once closed, so the close is not lost
+	// when its signal merged with a push
+	defer func() {
+		if q.size > 0 || q.closed {
+			q.signal()
+		}
+	}()
+	for p := len(q.buckets) - 1; p >= 0; p-- {
+		if len(q.buckets[p]) == 0 {
+			continue
+		}
+		data := q.buckets[p][0]
+		q.buckets[p][0] = nil
+		q.buckets[p] = q.buckets[p][1:]
+		q.size--
+		return data, true
+	}
+	return nil, false
+}
+
+func (q *SendQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.size
+}
+
+// Close stops further pushes; messages already queued can still be popped
+func (q *SendQueue) Close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	q.signal()
+}
+
+func (q *SendQueue) Closed() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.closed
+}
+
+// Ready is signalled when messages are waiting or the queue has been closed
+func (q *SendQueue) Ready() <-chan struct{} {
+	return q.ready
+}
+
+func (q *SendQueue) signal() {
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
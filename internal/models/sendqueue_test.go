@@ -0,0 +1,152 @@
+package models
+
+import (
+	"slices"
+	"testing"
+)
+
+type pushed struct {
+	data     string
+	priority int
+}
+
+func drain(q *SendQueue) []string {
+	var out []string
+	for {
+		data, ok := q.Pop()
+		if !ok {
+			return out
+		}
+		out = append(out, string(data))
+	}
+}
+
+func TestSendQueueOrder(t *testing.T) {
+	tests := []struct {
+		name   string
+		limit  int
+		pushes []pushed
+		failed []string // pushes reported as rejected
+		want   []string // pop order
+	}{
+		{
+			name:   "same priority keeps arrival order",
+			limit:  8,
+			pushes: []pushed{{"a", 0}, {"b", 0}, {"c", 0}},
+			want:   []string{"a", "b", "c"},
+		},
+		{
+			name:   "urgent first",
+			limit:  8,
+			pushes: []pushed{{"bulk", 0}, {"urgent", 9}, {"normal", 5}, {"bulk2", 0}},
+			want:   []string{"urgent", "normal", "bulk", "bulk2"},
+		},
+		{
+			name:   "priorities are clamped",
+			limit:  8,
+			pushes: []pushed{{"low", -3}, {"high", 50}, {"mid", 4}},
+			want:   []string{"high", "mid", "low"},
+		},
+		{
+			name:   "full queue evicts the oldest lowest priority",
+			limit:  3,
+			pushes: []pushed{{"a", 1}, {"b", 0}, {"c", 0}, {"d", 5}},
+			want:   []string{"d", "a", "c"},
+		},
+		{
+			name:   "full queue rejects what is not more urgent",
+			limit:  2,
+			pushes: []pushed{{"a", 3}, {"b", 3}, {"c", 3}, {"d", 2}},
+			failed: []string{"c", "d"},
+			want:   []string{"a", "b"},
+		},
+		{
+			name:   "replies overtake everything",
+			limit:  2,
+			pushes: []pushed{{"a", 9}, {"b", 9}, {"reply", replyPriority}},
+			want:   []string{"reply", "b"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := NewSendQueue(tt.limit)
+			var failed []string
+			for _, p := range tt.pushes {
+				if !q.Push([]byte(p.data), p.priority) {
+					failed = append(failed, p.data)
+				}
+			}
+			if !slices.Equal(failed, tt.failed) {
+				t.Errorf("rejected %v, want %v", failed, tt.failed)
+			}
+			if got := drain(q); !slices.Equal(got, tt.want) {
+				t.Errorf("popped %v, want %v", got, tt.want)
+			}
+			if q.Len() != 0 {
+				t.Errorf("Len() = %d after draining", q.Len())
+			}
+		})
+	}
+}
+
+func TestSendQueueClose(t *testing.T) {
+	q := NewSendQueue(4)
+	q.Push([]byte("a"), 0)
+	q.Push([]byte("b"), 0)
+	q.Close()
+
+	if q.Push([]byte("c"), 9) {
+		t.Error("Push succeeded on a closed queue")
+	}
+	if !q.Closed() {
+		t.Error("Closed() = false after Close")
+	}
+	if got := drain(q); !slices.Equal(got, []string{"a", "b"}) {
+		t.Errorf("popped %v after close, want [a b]", got)
+	}
+}
+
+// The close signal can merge with a pending push signal. The consumer must still be woken after
+// it drains the last message, or it waits on Ready forever.
+func TestSendQueueCloseSignalSurvivesDrain(t *testing.T) {
+	q := NewSendQueue(4)
+	q.Push([]byte("last"), 0)
+	q.Close()
+
+	<-q.Ready()
+	if _, ok := q.Pop(); !ok {
+		t.Fatal("Pop found nothing")
+	}
+	select {
+	case <-q.Ready():
+	default:
+		t.Fatal("Ready not signalled after draining a closed queue")
+	}
+	if _, ok := q.Pop(); ok || !q.Closed() {
+		t.Fatal("want an empty, closed queue")
+	}
+}
+
+func TestSendQueueReady(t *testing.T) {
+	q := NewSendQueue(4)
+	select {
+	case <-q.Ready():
+		t.Fatal("Ready signalled on an empty queue")
+	default:
+	}
+	q.Push([]byte("a"), 0)
+	q.Push([]byte("b"), 0)
+	<-q.Ready()
+	q.Pop()
+	select {
+	case <-q.Ready():
+	default:
+		t.Fatal("Ready not signalled while a message is left")
+	}
+	q.Pop()
+	select {
+	case <-q.Ready():
+		t.Fatal("Ready signalled on an empty open queue")
+	default:
+	}
+}
@@ -0,0 +1,200 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/sachinggsingh/notify/internal/filter"
+)
+
+// MaxSubscriptions caps the filters a single connection may register
+const MaxSubscriptions = 16
+
+// ClientFrame is a frame sent by a WebSocket client, e.g.
+// {"type":"subscribe","id":"alerts","topic":"uploads/+/images","filter":"metadata.severity in [\"high\"]"}
+// or {"type":"publish","id":"p1","message":{"topic":"chat/general","content":"hi"}}
+type ClientFrame struct {
+	Type    string          `json:"type"`
+	ID      string          `json:"id,omitempty"`
+	Topic   string          `json:"topic,omitempty"`
+	Filter  string          `json:"filter,omitempty"`
+	Message json.RawMessage `json:"message,omitempty"`
+}
+
+// ServerFrame answers a ClientFrame. Errors carry a machine-readable Code next to the message.
+type ServerFrame struct {
+	Type      string `json:"type"`
+	ID        string `json:"id,omitempty"`
+	Status    string `json:"status,omitempty"`
+	MessageID string `json:"message_id,omitempty"`
+	ReviewID  string `json:"review_id,omitempty"`
+	Code      string `json:"code,omitempty"`
+	Error     string `json:"error,omitempty"`
+
+	// Set on deliver frames sent to QoS 1 clients
+	DeliveryID  string          `json:"delivery_id,omitempty"`
+	Redelivered bool            `json:"redelivered,omitempty"`
+	Message     json.RawMessage `json:"message,omitempty"`
+}
+
+// subscription is one topic pattern and optional filter registered by a client
+type subscription struct {
+	pattern string
+	filter  *filter.Filter // nil matches everything
+	client  *Client
+}
+
+var errConnectionClosed = errors.New("connection is closed")
+
+// Subscribe registers a topic pattern (default #, every topic) and filter expression under id,
+// replacing any subscription with the same id. An empty expression matches every message.
+// Once a client has subscriptions it only receives messages that match one of them.
+func (c *Client) Subscribe(id, pattern, expr string) error {
+	if pattern == "" {
+		pattern = "#"
+	}
+	if err := ValidateTopicPattern(pattern); err != nil {
+		return err
+	}
+	sub := &subscription{pattern: pattern, client: c}
+	if expr != "" {
+		f, err := filter.Compile(expr)
+		if err != nil {
+			return err
+		}
+		sub.filter = f
+	}
+
+	h := c.Hub
+	h.Mutex.Lock()
+	defer h.Mutex.Unlock()
+	if !h.Clients[c] {
+		return errConnectionClosed
+	}
+	h.index()
+	if old, ok := c.subs[id]; ok {
+		h.topics.remove(old)
+	} else if len(c.subs) >= MaxSubscriptions {
+		return fmt.Errorf("at most %d subscriptions per connection", MaxSubscriptions)
+	}
+	if c.subs == nil {
+		c.subs = make(map[string]*subscription)
+	}
+	c.subs[id] = sub
+	h.topics.insert(sub)
+	delete(h.unfiltered, c)
+	return nil
+}
+
+// Unsubscribe removes a subscription. A client left without any goes back to receiving everything.
+func (c *Client) Unsubscribe(id string) bool {
+	h := c.Hub
+	h.Mutex.Lock()
+	defer h.Mutex.Unlock()
+	sub, ok := c.subs[id]
+	if !ok || !h.Clients[c] {
+		return false
+	}
+	delete(c.subs, id)
+	h.topics.remove(sub)
+	if len(c.subs) == 0 {
+		h.unfiltered[c] = struct{}{}
+	}
+	return true
+}
+
+// RetainedStore holds the last retained message of each topic
+type RetainedStore interface {
+	// Retained returns the unexpired retained messages on topics matching pattern
+	Retained(pattern string) ([][]byte, error)
+}
+
+// sendRetained queues the retained messages a new subscription matches
+func (c *Client) sendRetained(id string) {
+	h := c.Hub
+	h.Mutex.RLock()
+	sub := c.subs[id]
+	h.Mutex.RUnlock()
+	if sub == nil || h.Retained == nil {
+		return
+	}
+
+	messages, err := h.Retained.Retained(sub.pattern)
+	if err != nil {
+		log.Println("Failed to load retained messages:", err)
+		return
+	}
+	for _, message := range messages {
+		var doc map[string]any
+		if err := json.Unmarshal(message, &doc); err != nil {
+			continue
+		}
+		if sub.filter != nil && !sub.filter.Match(doc, c.UserID) {
+			continue
+		}
+		priority, _ := doc["priority"].(float64)
+		c.Send.Push(message, int(priority))
+	}
+}
+
+// handleFrame processes one inbound frame and returns the reply
+func (c *Client) handleFrame(data []byte) ServerFrame {
+	var frame ClientFrame
+	if err := json.Unmarshal(data, &frame); err != nil {
+		return ServerFrame{Type: "error", Code: "invalid_frame", Error: "invalid frame"}
+	}
+	if frame.ID == "" && frame.Type != "publish" && frame.Type != "ack" {
+		frame.ID = "default"
+	}
+
+	switch frame.Type {
+	case "subscribe":
+		if err := c.Subscribe(frame.ID, frame.Topic, frame.Filter); err != nil {
+			return ServerFrame{Type: "error", ID: frame.ID, Code: "invalid_subscription", Error: err.Error()}
+		}
+		c.reply(ServerFrame{Type: "suback", ID: frame.ID})
+		c.sendRetained(frame.ID)
+		return ServerFrame{}
+	case "unsubscribe":
+		if !c.Unsubscribe(frame.ID) {
+			return ServerFrame{Type: "error", ID: frame.ID, Code: "unknown_subscription", Error: "unknown subscription"}
+		}
+		return ServerFrame{Type: "unsuback", ID: frame.ID}
+	case "publish":
+		if c.Hub.OnPublish == nil {
+			return ServerFrame{Type: "puback", ID: frame.ID, Code: "unsupported", Error: "publishing over WebSocket is not enabled"}
+		}
+		return c.Hub.OnPublish(c, frame)
+	case "ack":
+		// Acks are not answered; unknown IDs were acked already or belong to another connection
+		if c.qos != nil {
+			c.qos.ack(frame.ID)
+		}
+		return ServerFrame{}
+	}
+	return ServerFrame{Type: "error", ID: frame.ID, Code: "unknown_type", Error: fmt.Sprintf("unknown frame type %q", frame.Type)}
+}
+
+// reply queues a frame for this client only. It is dropped if the client has gone or is backed up.
+// QoS 1 clients get replies on a separate queue so they are not wrapped as deliveries.
+func (c *Client) reply(frame ServerFrame) {
+	data, err := json.Marshal(frame)
+	if err != nil {
+		return
+	}
+	c.Hub.Mutex.RLock()
+	defer c.Hub.Mutex.RUnlock()
+	if !c.Hub.Clients[c] {
+		return
+	}
+	if c.qos != nil {
+		select {
+		case c.qos.control <- data:
+		default:
+		}
+		return
+	}
+	c.Send.Push(data, replyPriority)
+}
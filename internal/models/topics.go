@@ -0,0 +1,129 @@
+package models
+
+import (
+	"errors"
+	"strings"
+)
+
+// MaxTopicLength bounds topic names and subscription patterns
+const MaxTopicLength = 256
+
+// ValidateTopic checks a topic a message is published to. Topics are hierarchical, with levels
+// separated by "/" (uploads/team-a/images); the wildcards + and # are only valid in subscriptions.
+// The empty topic is allowed and is matched only by the # wildcard.
+func ValidateTopic(topic string) error {
+	if len(topic) > MaxTopicLength {
+		return errors.New("topic is too long")
+	}
+	if strings.ContainsAny(topic, "+#") {
+		return errors.New("topic cannot contain the wildcards + or #")
+	}
+	return nil
+}
+
+// ValidateTopicPattern checks a subscription pattern. + matches exactly one level and
+// # matches any number of trailing levels, so it must be the last one.
+func ValidateTopicPattern(pattern string) error {
+	if pattern == "" {
+		return errors.New("topic pattern is empty")
+	}
+	if len(pattern) > MaxTopicLength {
+		return errors.New("topic pattern is too long")
+	}
+	levels := strings.Split(pattern, "/")
+	for i, level := range levels {
+		switch {
+		case level == "#" && i != len(levels)-1:
+			return errors.New("# must be the last level of a topic pattern")
+		case level != "+" && level != "#" && strings.ContainsAny(level, "+#"):
+			return errors.New("wildcards must occupy a whole topic level")
+		}
+	}
+	return nil
+}
+
+// TopicMatches reports whether topic matches a subscription pattern, with the same rules as the
+// hub's subscription trie
+func TopicMatches(pattern, topic string) bool {
+	patternLevels := strings.Split(pattern, "/")
+	var levels []string
+	if topic != "" {
+		levels = strings.Split(topic, "/")
+	}
+	for i, p := range patternLevels {
+		if p == "#" {
+			return true
+		}
+		if i >= len(levels) || (p != "+" && p != levels[i]) {
+			return false
+		}
+	}
+	return len(patternLevels) == len(levels)
+}
+
+// topicNode is one level of the subscription trie. Broadcasting walks only the branches that
+// can match the message topic instead of checking every client.
+type topicNode struct {
+	children map[string]*topicNode
+	subs     map[*subscription]struct{}
+}
+
+func newTopicNode() *topicNode {
+	return &topicNode{children: map[string]*topicNode{}, subs: map[*subscription]struct{}{}}
+}
+
+func (n *topicNode) insert(sub *subscription) {
+	for _, level := range strings.Split(sub.pattern, "/") {
+		child, ok := n.children[level]
+		if !ok {
+			child = newTopicNode()
+			n.children[level] = child
+		}
+		n = child
+	}
+	n.subs[sub] = struct{}{}
+}
+
+// remove deletes sub and prunes branches left empty
+func (n *topicNode) remove(sub *subscription) {
+	n.removeLevels(strings.Split(sub.pattern, "/"), sub)
+}
+
+func (n *topicNode) removeLevels(levels []string, sub *subscription) bool {
+	if len(levels) == 0 {
+		delete(n.subs, sub)
+	} else if child, ok := n.children[levels[0]]; ok && child.removeLevels(levels[1:], sub) {
+		delete(n.children, levels[0])
+	}
+	return len(n.subs) == 0 && len(n.children) == 0
+}
+
+// match calls fn for every subscription whose pattern matches topic
+func (n *topicNode) match(topic string, fn func(*subscription)) {
+	var levels []string
+	if topic != "" {
+		levels = strings.Split(topic, "/")
+	}
+	n.matchLevels(levels, fn)
+}
+
+func (n *topicNode) matchLevels(levels []string, fn func(*subscription)) {
+	// # also matches the parent level: sport/# matches sport
+	if child, ok := n.children["#"]; ok {
+		for sub := range child.subs {
+			fn(sub)
+		}
+	}
+	if len(levels) == 0 {
+		for sub := range n.subs {
+			fn(sub)
+		}
+		return
+	}
+	if child, ok := n.children[levels[0]]; ok {
+		child.matchLevels(levels[1:], fn)
+	}
+	if child, ok := n.children["+"]; ok {
+		child.matchLevels(levels[1:], fn)
+	}
+}
@@ -0,0 +1,142 @@
+package models
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+var topicMatchTests = []struct {
+	pattern, topic string
+	want           bool
+}{
+	{"sport/tennis", "sport/tennis", true},
+	{"sport/tennis", "sport/golf", false},
+	{"sport/tennis", "sport", false},
+	{"sport/tennis", "sport/tennis/player1", false},
+	{"sport/+", "sport/tennis", true},
+	{"sport/+", "sport", false},
+	{"sport/+", "sport/tennis/player1", false},
+	{"sport/+/player1", "sport/tennis/player1", true},
+	{"sport/+/player1", "sport/tennis/player2", false},
+	{"+/+", "sport/tennis", true},
+	{"+", "sport", true},
+	{"+", "", false},
+	{"sport/#", "sport", true},
+	{"sport/#", "sport/tennis/player1", true},
+	{"sport/#", "sports", false},
+	{"#", "", true},
+	{"#", "a/b/c", true},
+	{"+/tennis/#", "sport/tennis", true},
+	{"+/tennis/#", "sport/tennis/player1/ranking", true},
+	{"+/tennis/#", "sport/golf/player1", false},
+	{"uploads/team-a", "", false},
+}
+
+func TestTopicMatches(t *testing.T) {
+	for _, tt := range topicMatchTests {
+		if got := TopicMatches(tt.pattern, tt.topic); got != tt.want {
+			t.Errorf("TopicMatches(%q, %q) = %v, want %v", tt.pattern, tt.topic, got, tt.want)
+		}
+	}
+}
+
+// The trie must route exactly like TopicMatches
+func TestTopicTrieMatch(t *testing.T) {
+	root := newTopicNode()
+	subs := map[string]*subscription{}
+	for _, tt := range topicMatchTests {
+		if subs[tt.pattern] == nil {
+			subs[tt.pattern] = &subscription{pattern: tt.pattern}
+			root.insert(subs[tt.pattern])
+		}
+	}
+
+	topics := map[string]bool{}
+	for _, tt := range topicMatchTests {
+		topics[tt.topic] = true
+	}
+	for topic := range topics {
+		var got, want []string
+		root.match(topic, func(sub *subscription) { got = append(got, sub.pattern) })
+		for pattern := range subs {
+			if TopicMatches(pattern, topic) {
+				want = append(want, pattern)
+			}
+		}
+		slices.Sort(got)
+		slices.Sort(want)
+		if !slices.Equal(got, want) {
+			t.Errorf("topic %q matched %v, want %v", topic, got, want)
+		}
+	}
+}
+
+func TestTopicTrieRemove(t *testing.T) {
+	root := newTopicNode()
+	a := &subscription{pattern: "sport/+/player1"}
+	b := &subscription{pattern: "sport/+/player1"}
+	c := &subscription{pattern: "sport/#"}
+	for _, sub := range []*subscription{a, b, c} {
+		root.insert(sub)
+	}
+
+	root.remove(a)
+	var got []*subscription
+	root.match("sport/tennis/player1", func(sub *subscription) { got = append(got, sub) })
+	if len(got) != 2 || slices.Contains(got, a) {
+		t.Fatalf("after removing one subscription matched %d, want b and c", len(got))
+	}
+
+	root.remove(b)
+	root.remove(c)
+	if len(root.children) != 0 || len(root.subs) != 0 {
+		t.Errorf("trie not pruned after removing every subscription: %+v", root.children)
+	}
+
+	// Removing something that was never inserted is harmless
+	root.remove(&subscription{pattern: "news/+"})
+}
+
+func TestValidateTopic(t *testing.T) {
+	tests := []struct {
+		topic   string
+		wantErr bool
+	}{
+		{"", false},
+		{"uploads/team-a/images", false},
+		{"uploads/+", true},
+		{"uploads/#", true},
+		{"a#b", true},
+		{strings.Repeat("a", MaxTopicLength), false},
+		{strings.Repeat("a", MaxTopicLength+1), true},
+	}
+	for _, tt := range tests {
+		if err := ValidateTopic(tt.topic); (err != nil) != tt.wantErr {
+			t.Errorf("ValidateTopic(%q) = %v, wantErr %v", tt.topic, err, tt.wantErr)
+		}
+	}
+}
+
+func TestValidateTopicPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		wantErr bool
+	}{
+		{"sport/tennis", false},
+		{"sport/+/player1", false},
+		{"sport/#", false},
+		{"#", false},
+		{"+", false},
+		{"", true},
+		{"sport/#/player1", true},
+		{"sport/ten+nis", true},
+		{"sport/tennis#", true},
+		{strings.Repeat("a", MaxTopicLength+1), true},
+	}
+	for _, tt := range tests {
+		if err := ValidateTopicPattern(tt.pattern); (err != nil) != tt.wantErr {
+			t.Errorf("ValidateTopicPattern(%q) = %v, wantErr %v", tt.pattern, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,321 @@
+// Package queue is a small durable job queue on Redis. Jobs survive restarts: a worker
+// moves a job id from the ready list to the processing list and holds a lease on it;
+// if the worker dies, the lease expires and the job is put back on the ready list.
+package queue
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	config "github.com/sachinggsingh/notify/internal/config"
+)
+
+const (
+	readyKey      = "jobs:ready"
+	processingKey = "jobs:processing"
+	delayedKey    = "jobs:delayed"
+	leasesKey     = "jobs:leases"
+)
+
+const (
+	StatusQueued   = "queued"
+	StatusRunning  = "running"
+	StatusRetrying = "retrying"
+	StatusDone     = "done"
+	StatusFailed   = "failed"
+)
+
+// How long finished jobs stay readable through Get
+const (
+	doneRetention   = 24 * time.Hour
+	failedRetention = 7 * 24 * time.Hour
+)
+
+type Job struct {
+	ID          string          `json:"id"`
+	Kind        string          `json:"kind"`
+	Payload     json.RawMessage `json:"payload"`
+	Status      string          `json:"status"`
+	Attempts    int             `json:"attempts"`
+	MaxAttempts int             `json:"max_attempts"`
+	LastError   string          `json:"last_error,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+}
+
+// Decode unmarshals the job payload into v
+func (j *Job) Decode(v any) error {
+	return json.Unmarshal(j.Payload, v)
+}
+
+// LastAttempt reports whether a failure of the current attempt is final
+func (j *Job) LastAttempt() bool {
+	return j.Attempts >= j.MaxAttempts
+}
+
+// Handler processes one job. Returning an error schedules a retry until MaxAttempts is reached.
+type Handler func(ctx context.Context, job *Job) error
+
+var (
+	handlersMu sync.RWMutex
+	handlers   = map[string]Handler{}
+)
+
+// Handle registers the handler for a job kind; call it before Run
+func Handle(kind string, h Handler) {
+	handlersMu.Lock()
+	defer handlersMu.Unlock()
+	handlers[kind] = h
+}
+
+func jobKey(id string) string {
+	return "job:" + id
+}
+
+// Enqueue persists a job and makes it available to workers
+func Enqueue(ctx context.Context, kind string, payload any) (string, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	id := hex.EncodeToString(b)
+	now := time.Now()
+	job := &Job{
+		ID:          id,
+		Kind:        kind,
+		Payload:     data,
+		Status:      StatusQueued,
+		MaxAttempts: config.Jobs.MaxAttempts,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	raw, err := json.Marshal(job)
+	if err != nil {
+		return "", err
+	}
+	_, err = config.RDB.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, jobKey(id), raw, 0)
+		pipe.LPush(ctx, readyKey, id)
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// Get returns a job by id; finished jobs are kept for a while after they complete
+func Get(ctx context.Context, id string) (*Job, error) {
+	raw, err := config.RDB.Get(ctx, jobKey(id)).Bytes()
+	if err != nil {
+		return nil, err
+	}
+	var job Job
+	if err := json.Unmarshal(raw, &job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func save(ctx context.Context, job *Job, ttl time.Duration) error {
+	job.UpdatedAt = time.Now()
+	raw, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	return config.RDB.Set(ctx, jobKey(job.ID), raw, ttl).Err()
+}
+
+// Run starts config.Jobs.Concurrency workers and the scheduler, and blocks until ctx is cancelled
+func Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := 0; i < config.Jobs.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			work(ctx)
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		schedule(ctx)
+	}()
+	wg.Wait()
+}
+
+func work(ctx context.Context) {
+	for ctx.Err() == nil {
+		id, err := config.RDB.BLMove(ctx, readyKey, processingKey, "RIGHT", "LEFT", 5*time.Second).Result()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Println("queue: failed to fetch job:", err)
+			time.Sleep(time.Second)
+			continue
+		}
+		process(ctx, id)
+	}
+}
+
+func process(ctx context.Context, id string) {
+	lease := time.Now().Add(config.Jobs.VisibilityTimeout)
+	config.RDB.ZAdd(ctx, leasesKey, redis.Z{Score: float64(lease.UnixMilli()), Member: id})
+
+	job, err := Get(ctx, id)
+	if err != nil {
+		if err != redis.Nil {
+			log.Println("queue: failed to load job", id, err)
+			return // the lease expires and the job is retried
+		}
+		ack(ctx, id) // job record is gone, nothing to do
+		return
+	}
+
+	job.Attempts++
+	job.Status = StatusRunning
+	if err := save(ctx, job, 0); err != nil {
+		log.Println("queue: failed to update job", id, err)
+		return
+	}
+
+	err = runHandler(ctx, job)
+	if err == nil {
+		job.Status = StatusDone
+		job.LastError = ""
+		if err := save(ctx, job, doneRetention); err != nil {
+			log.Println("queue: failed to update job", id, err)
+		}
+		ack(ctx, id)
+		return
+	}
+
+	job.LastError = err.Error()
+	if job.LastAttempt() {
+		log.Printf("queue: %s job %s failed after %d attempts: %v", job.Kind, id, job.Attempts, err)
+		job.Status = StatusFailed
+		if err := save(ctx, job, failedRetention); err != nil {
+			log.Println("queue: failed to update job", id, err)
+		}
+		ack(ctx, id)
+		return
+	}
+
+	job.Status = StatusRetrying
+	if err := save(ctx, job, 0); err != nil {
+		log.Println("queue: failed to update job", id, err)
+		return
+	}
+	retryAt := time.Now().Add(config.Jobs.Backoff(job.Attempts))
+	_, err = config.RDB.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.LRem(ctx, processingKey, 1, id)
+		pipe.ZRem(ctx, leasesKey, id)
+		pipe.ZAdd(ctx, delayedKey, redis.Z{Score: float64(retryAt.UnixMilli()), Member: id})
+		return nil
+	})
+	if err != nil {
+		log.Println("queue: failed to schedule retry for job", id, err)
+	}
+}
+
+// runHandler runs the handler for job within the visibility timeout, turning panics into errors
+func runHandler(ctx context.Context, job *Job) (err error) {
+	handlersMu.RLock()
+	h, ok := handlers[job.Kind]
+	handlersMu.RUnlock()
+	if !ok {
+		job.Attempts = job.MaxAttempts // retrying will not help
+		return fmt.Errorf("no handler registered for job kind %q", job.Kind)
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	jobCtx, cancel := context.WithTimeout(ctx, config.Jobs.VisibilityTimeout)
+	defer cancel()
+	return h(jobCtx, job)
+}
+
+func ack(ctx context.Context, id string) {
+	_, err := config.RDB.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.LRem(ctx, processingKey, 1, id)
+		pipe.ZRem(ctx, leasesKey, id)
+		return nil
+	})
+	if err != nil {
+		log.Println("queue: failed to acknowledge job", id, err)
+	}
+}
+
+// promoteScript moves delayed jobs whose retry time has come onto the ready list
+var promoteScript = redis.NewScript(`
+local ids = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, 100)
+for _, id in ipairs(ids) do
+  redis.call('ZREM', KEYS[1], id)
+  redis.call('LPUSH', KEYS[2], id)
+end
+return #ids
+`)
+
+// reapScript requeues jobs whose lease expired. Jobs in the processing list without a
+// lease (their worker died right after taking them) are given one, so they are reaped later.
+var reapScript = redis.NewScript(`
+local ids = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, 100)
+for _, id in ipairs(ids) do
+  redis.call('ZREM', KEYS[1], id)
+  if redis.call('LREM', KEYS[2], 1, id) > 0 then
+    redis.call('LPUSH', KEYS[3], id)
+  end
+end
+for _, id in ipairs(redis.call('LRANGE', KEYS[2], 0, 999)) do
+  if not redis.call('ZSCORE', KEYS[1], id) then
+    redis.call('ZADD', KEYS[1], ARGV[2], id)
+  end
+end
+return #ids
+`)
+
+func schedule(ctx context.Context) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		now := time.Now()
+		nowMs := strconv.FormatInt(now.UnixMilli(), 10)
+		if err := promoteScript.Run(ctx, config.RDB, []string{delayedKey, readyKey}, nowMs).Err(); err != nil && !errors.Is(err, context.Canceled) {
+			log.Println("queue: failed to promote delayed jobs:", err)
+		}
+		lease := strconv.FormatInt(now.Add(config.Jobs.VisibilityTimeout).UnixMilli(), 10)
+		n, err := reapScript.Run(ctx, config.RDB, []string{leasesKey, processingKey, readyKey}, nowMs, lease).Int()
+		if err != nil && !errors.Is(err, context.Canceled) {
+			log.Println("queue: failed to requeue expired jobs:", err)
+		}
+		if n > 0 {
+			log.Printf("queue: requeued %d jobs whose worker stopped responding", n)
+		}
+	}
+}
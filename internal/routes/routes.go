@@ -10,7 +10,47 @@ import (
 
 func UserRoutes(incommingRoutes *gin.Engine) {
 	incommingRoutes.POST("/user/signup", controller.CreateUser())
-	incommingRoutes.POST("/user/login", controller.Login())
+	incommingRoutes.POST("/user/login", middleware.RateLimit("login"), controller.Login())
+	incommingRoutes.GET("/user/oidc/login", controller.OIDCLogin())
+	incommingRoutes.GET("/user/oidc/callback", controller.OIDCCallback())
+	incommingRoutes.GET("/user/verify", controller.VerifyEmail())
+	incommingRoutes.POST("/user/verify/request", middleware.RateLimit("account"), controller.RequestVerification())
+	incommingRoutes.POST("/user/password/forgot", middleware.RateLimit("account"), controller.ForgotPassword())
+	incommingRoutes.POST("/user/password/reset", middleware.RateLimit("account"), controller.ResetPassword())
+}
+
+func ProfileRoutes(incommingRoutes *gin.Engine) {
+	protectedRoutes := incommingRoutes.Group("/protected")
+	protectedRoutes.Use(middleware.Authenticate())
+	{
+		protectedRoutes.GET("/me", controller.GetProfile())
+		protectedRoutes.PATCH("/me", controller.UpdateProfile())
+		protectedRoutes.POST("/me/password", controller.ChangePassword())
+		protectedRoutes.DELETE("/me", controller.DeleteAccount())
+	}
+}
+
+func AdminRoutes(incommingRoutes *gin.Engine) {
+	adminRoutes := incommingRoutes.Group("/admin")
+	adminRoutes.Use(middleware.Authenticate(), middleware.RequireAdmin())
+	{
+		adminRoutes.GET("/users", controller.ListUsers())
+		adminRoutes.PATCH("/users/:user_id", controller.SetUserDisabled())
+
+		adminRoutes.GET("/prompts", controller.ListPromptTemplates())
+		adminRoutes.GET("/prompts/:name", controller.GetPromptTemplate())
+		adminRoutes.PUT("/prompts/:name", controller.PutPromptTemplate())
+		adminRoutes.DELETE("/prompts/:name", controller.DeletePromptTemplate())
+
+		adminRoutes.GET("/reviews", controller.ListReviews())
+		adminRoutes.POST("/reviews/:review_id/approve", controller.ApproveReview())
+		adminRoutes.POST("/reviews/:review_id/reject", controller.RejectReview())
+
+		adminRoutes.GET("/retention", controller.ListRetentionPolicies())
+		adminRoutes.PUT("/retention", controller.PutRetentionPolicy())
+		adminRoutes.DELETE("/retention", controller.DeleteRetentionPolicy())
+		adminRoutes.GET("/storage/messages", controller.MessageStorage())
+	}
 }
 
 func ImageRoutes(incommingRoutes *gin.Engine) {
@@ -18,11 +58,27 @@ func ImageRoutes(incommingRoutes *gin.Engine) {
 	protectedRoutes := incommingRoutes.Group("/protected")
 	protectedRoutes.Use(middleware.Authenticate())
 	{
+		protectedRoutes.GET("/images", controller.ListImages())
 		protectedRoutes.GET("/image/:image_id", controller.GetImage())
-		protectedRoutes.POST("/upload", controller.UploadFile())
+		protectedRoutes.DELETE("/image/:image_id", controller.DeleteImage())
+		protectedRoutes.GET("/image/:image_id/caption", controller.GetImageCaption())
+		protectedRoutes.POST("/upload", middleware.RateLimit("upload"), controller.UploadFile())
+		protectedRoutes.POST("/uploads", middleware.RateLimit("upload"), controller.UploadFiles())
+
+		protectedRoutes.POST("/uploads/resumable", middleware.RateLimit("upload"), controller.CreateResumableUpload())
+		protectedRoutes.HEAD("/uploads/resumable/:upload_id", controller.ResumableUploadStatus())
+		protectedRoutes.GET("/uploads/resumable/:upload_id", controller.ResumableUploadStatus())
+		protectedRoutes.PATCH("/uploads/resumable/:upload_id", controller.PatchResumableUpload())
+		protectedRoutes.POST("/uploads/resumable/:upload_id/finalize", controller.FinalizeResumableUpload())
+		protectedRoutes.DELETE("/uploads/resumable/:upload_id", controller.AbortResumableUpload())
 	}
 }
 
+// FileRoutes serves local-storage uploads; access is granted by the URL signature, not a token
+func FileRoutes(incommingRoutes *gin.Engine) {
+	incommingRoutes.GET("/files/*key", controller.ServeFile())
+}
+
 func WebsocketRoutes(incommingRoutes *gin.Engine) {
 	protectedRoutes := incommingRoutes.Group("/protected")
 	protectedRoutes.Use(middleware.Authenticate())
@@ -36,6 +92,16 @@ func PubSubRoutes(incommingRoutes *gin.Engine) {
 	protectedRoutes := incommingRoutes.Group("/protected")
 	protectedRoutes.Use(middleware.Authenticate())
 	{
-		protectedRoutes.POST("/publish", controller.PublishMessage())
+		protectedRoutes.POST("/publish", middleware.RateLimit("publish"), controller.PublishMessage())
+		protectedRoutes.GET("/messages", controller.ListMessages())
+		protectedRoutes.PATCH("/messages/:message_id", controller.EditMessage())
+		protectedRoutes.DELETE("/messages/:message_id", controller.DeleteMessage())
+		protectedRoutes.GET("/messages/:message_id/thread", controller.GetThread())
+		protectedRoutes.GET("/messages/:message_id/reactions", controller.ListReactions())
+		protectedRoutes.PUT("/messages/:message_id/reactions/:emoji", controller.AddReaction())
+		protectedRoutes.DELETE("/messages/:message_id/reactions/:emoji", controller.RemoveReaction())
+		protectedRoutes.GET("/scheduled", controller.ListScheduledMessages())
+		protectedRoutes.DELETE("/scheduled/:message_id", controller.CancelScheduledMessage())
+		protectedRoutes.GET("/topics/*path", controller.GetRetainedMessage())
 	}
 }